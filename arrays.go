@@ -0,0 +1,383 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ArrayInfo - go type information of an array column. The VO holds a slice
+// with dims levels of elem.voType, the Rec either a pgtype array or a text
+// format array generated into Types.go
+type ArrayInfo struct {
+	elem    GoColInfo
+	dims    int
+	recType string
+}
+
+// pgArrayTypes - pgtype array types by the typname of their elements
+var pgArrayTypes = map[string]string{
+	"bool":        "pgtype.BoolArray",
+	"bytea":       "pgtype.ByteaArray",
+	"int2":        "pgtype.Int2Array",
+	"int4":        "pgtype.Int4Array",
+	"int8":        "pgtype.Int8Array",
+	"float4":      "pgtype.Float4Array",
+	"float8":      "pgtype.Float8Array",
+	"text":        "pgtype.TextArray",
+	"varchar":     "pgtype.VarcharArray",
+	"bpchar":      "pgtype.BPCharArray",
+	"timestamp":   "pgtype.TimestampArray",
+	"timestamptz": "pgtype.TimestamptzArray",
+	"date":        "pgtype.DateArray",
+	"uuid":        "pgtype.UUIDArray",
+	"inet":        "pgtype.InetArray",
+	"cidr":        "pgtype.CIDRArray",
+	"numeric":     "pgtype.NumericArray",
+}
+
+// isArray - true for array columns, whether read from the catalog, a
+// migration file or the field descriptions of a query
+func (col *ColDesc) isArray() bool {
+	return col.DataType == "ARRAY" || col.Dimensions > 0 || strings.HasPrefix(col.DataType, "_") ||
+		lookupBuiltinArrayOID(col.TypeOID) != nil
+}
+
+// elemColDesc - description of the elements of an array column
+func (col *ColDesc) elemColDesc() ColDesc {
+	elem := ColDesc{
+		TableSchema: col.TableSchema,
+		TableName:   col.TableName,
+		ColumnName:  col.ColumnName,
+		IsNullable:  true,
+		TypeOID:     col.ElemTypeOID,
+		TypeMod:     col.TypeMod,
+		TypeName:    strings.TrimPrefix(col.TypeName, "_"),
+		TypeSchema:  col.TypeSchema,
+		DataType:    "USER-DEFINED",
+	}
+	if elem.TypeName == "" {
+		elem.TypeName = strings.TrimPrefix(col.DataType, "_")
+	}
+	bt := lookupBuiltinOID(elem.TypeOID)
+	if bt == nil && elem.TypeOID == 0 {
+		if bt = lookupBuiltinArrayOID(col.TypeOID); bt == nil && elem.TypeSchema == "pg_catalog" {
+			bt = lookupBuiltinType(elem.TypeName)
+		}
+	}
+	if bt != nil {
+		elem.DataType = bt.dataType
+		elem.TypeName = bt.typName
+		elem.TypeOID = bt.oid
+		elem.TypeSchema = "pg_catalog"
+		elem.TypeKind = "b"
+	}
+	return elem
+}
+
+// arrayColInfo - go type information for an array column. The pgtype array
+// types are used where the element type matches, all other arrays are read
+// and written in text format. With a NullMode the elements are nullable VO
+// types as well
+func (meta *DBMeta) arrayColInfo(col *ColDesc) GoColInfo {
+	elemCol := col.elemColDesc()
+	elemCol.goInfo = meta.goColInfo(&elemCol)
+	a := &ArrayInfo{elem: meta.nullableColInfo(&elemCol), dims: col.Dimensions}
+	a.elem.nullable = true
+	if a.dims < 1 {
+		a.dims = 1
+	}
+	a.recType = pgArrayTypes[elemCol.TypeName]
+	if elemCol.TypeKind != "b" || a.recType == "" || a.elem.recType != strings.TrimSuffix(a.recType, "Array") {
+		a.recType = textArrayName(a.elem.recType)
+	}
+	// pgx v5 reads and writes arrays of any element type it can handle
+	if meta.target() == "pgx5" {
+		a.recType = "pgtype.Array[" + a.elem.recType + "]"
+	}
+	return GoColInfo{
+		voType:    strings.Repeat("[]", a.dims) + a.elem.voType,
+		recType:   a.recType,
+		nullValue: "nil",
+		array:     a,
+	}
+}
+
+// textArrayName - name of the generated text format array type holding
+// elements of the given Rec type
+func textArrayName(elemRecType string) string {
+	switch {
+	case strings.HasPrefix(elemRecType, "pgtype."):
+		return strings.TrimPrefix(elemRecType, "pgtype.") + "TextArray"
+	case strings.HasPrefix(elemRecType, "sql.Null["):
+		return "Null" + goTypeSuffix(strings.TrimPrefix(elemRecType, "sql.Null")) + "Array"
+	case strings.HasPrefix(elemRecType, "sql."):
+		return strings.TrimPrefix(elemRecType, "sql.") + "Array"
+	}
+	return strings.TrimSuffix(elemRecType, "Rec") + "Array"
+}
+
+// isTextArray - true if the Rec type is generated rather than a pgtype array
+func (a *ArrayInfo) isTextArray() bool {
+	return !strings.HasPrefix(a.recType, "pgtype.")
+}
+
+// isPgx5 - true for the generic pgtype.Array of pgx v5
+func (a *ArrayInfo) isPgx5() bool {
+	return strings.HasPrefix(a.recType, "pgtype.Array[")
+}
+
+// recName - the Rec type as a part of a function name
+func (a *ArrayInfo) recName() string {
+	if a.isPgx5() {
+		return strings.TrimPrefix(goTypeSuffix(a.elem.recType), "Pgtype") + "Array"
+	}
+	return strings.TrimPrefix(a.recType, "pgtype.")
+}
+
+// dimsField - the field of the Rec type holding the array dimensions
+func (a *ArrayInfo) dimsField() string {
+	if len(a.elem.target) > 0 {
+		return "Dims"
+	}
+	return "Dimensions"
+}
+
+// dimType - the type of the array dimensions, generated for database/sql
+func (a *ArrayInfo) dimType() string {
+	if a.elem.target == "sql" {
+		return "ArrayDimension"
+	}
+	return "pgtype.ArrayDimension"
+}
+
+// goTypeSuffix - go type turned into a part of a function name, e.g.
+// PtrModelPayload for *model.Payload
+func goTypeSuffix(goType string) string {
+	goType = strings.Replace(goType, "[]", "Slice.", -1)
+	goType = strings.Replace(goType, "*", "Ptr.", -1)
+	suffix := ""
+	for _, part := range strings.FieldsFunc(goType, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		suffix += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return suffix
+}
+
+// holdsNull - true if the VO elements can hold NULL, as a nullable VO type
+// of the NullMode or a nil pointer of a type override
+func (a *ArrayInfo) holdsNull() bool {
+	return a.elem.inner != nil || (a.elem.override != nil && strings.HasPrefix(a.elem.voType, "*"))
+}
+
+// toVOFails - true if the conversion to the VO can fail: on elements that
+// can not be read, NULL elements the VO can not hold, or another number of
+// dimensions than the column has
+func (a *ArrayInfo) toVOFails() bool {
+	return a.elem.fromFails() || !a.holdsNull() || a.dims > 1
+}
+
+// funcSuffix - part of the conversion function names describing the VO type
+func (a *ArrayInfo) funcSuffix() string {
+	suffix := goTypeSuffix(a.elem.voType)
+	if a.dims > 1 {
+		suffix += fmt.Sprintf("%dD", a.dims)
+	}
+	return suffix
+}
+
+// toVOFunc - name of the generated function converting the Rec to the VO
+func (a *ArrayInfo) toVOFunc() string {
+	return "daogen" + a.recName() + "To" + a.funcSuffix()
+}
+
+// fromVOFunc - name of the generated function converting the VO to the Rec
+func (a *ArrayInfo) fromVOFunc() string {
+	return "daogen" + a.recName() + "From" + a.funcSuffix()
+}
+
+// genArrayFuncs - the functions converting between the Rec and the VO form
+// of an array. NULL elements are read into nullable VO elements, and fail
+// the conversion where the VO element can not hold NULL, as do non empty
+// arrays with another number of dimensions than the column
+func genArrayFuncs(a *ArrayInfo) {
+	voType := strings.Repeat("[]", a.dims) + a.elem.voType
+
+	//=========   Generate the conversion to VO ===========
+	{
+		// Elements that can not be read fail the whole array
+		results, noErr := voType, ""
+		if a.toVOFails() {
+			results, noErr = "("+voType+", error)", ", nil"
+		}
+		null := fmt.Sprintf("flat[i] = %s", a.elem.nullVO())
+		if !a.holdsNull() {
+			null = fmt.Sprintf(`return nil, fmt.Errorf("%s: NULL element, which %s can not hold")`,
+				a.toVOFunc(), a.elem.voType)
+		}
+		ff(`// %s - VO form of a %s
+func %s(a %s) %s {
+	flat := make([]%s, len(a.Elements))
+	for i, f := range a.Elements {
+		if %s {
+			%s
+		} else {
+			%s
+		}
+	}
+`, a.toVOFunc(), a.recType, a.toVOFunc(), a.recType, results, a.elem.voType,
+			a.elem.isPresent("f"), a.elem.readVO("f", "flat[i]", "return nil, err"), null)
+		if a.dims == 1 {
+			ff("\treturn flat%s\n}\n\n", noErr)
+		} else {
+			ff("\tif len(flat) == 0 {\n\t\treturn %s{}%s\n\t}\n", voType, noErr)
+			ff("\tif len(a.%s) != %d {\n\t\treturn nil, fmt.Errorf(\"%s: expected %d dimensions, got %%d\", len(a.%s))\n\t}\n",
+				a.dimsField(), a.dims, a.toVOFunc(), a.dims, a.dimsField())
+			ff("\tv1 := flat\n")
+			for k := 2; k <= a.dims; k++ {
+				ff("\tv%d := %s{}\n", k, strings.Repeat("[]", k)+a.elem.voType)
+				ff("\tfor i, n := 0, int(a.%s[%d].Length); i < len(v%d); i += n {\n", a.dimsField(), a.dims-k+1, k-1)
+				ff("\t\tv%d = append(v%d, v%d[i:i+n])\n\t}\n", k, k, k-1)
+			}
+			ff("\treturn v%d%s\n}\n\n", a.dims, noErr)
+		}
+	}
+	//-------------------------------------
+
+	//=========   Generate the conversion from VO ===========
+	{
+		nullStatus, presentStatus := "Status: pgtype.Null", "Status: pgtype.Present"
+		if len(a.elem.target) > 0 {
+			nullStatus, presentStatus = "", "Valid: true"
+		}
+		// Elements that can not be converted fail the whole array
+		results, noErr := a.recType, ""
+		if a.elem.toFails() {
+			results, noErr = "("+a.recType+", error)", ", nil"
+		}
+		ff(`// %s - %s holding the VO. A nil VO is written as NULL
+func %s(vo %s) %s {
+	if vo == nil {
+		return %s{%s}%s
+	}
+	a := %s{%s}
+	lengths := make([]int32, %d)
+	lengths[0] = int32(len(vo))
+`, a.fromVOFunc(), a.recType, a.fromVOFunc(), voType, results, a.recType, nullStatus, noErr,
+			a.recType, presentStatus, a.dims)
+		elemRecType := a.elem.recType
+		if !a.isTextArray() && !a.isPgx5() {
+			elemRecType = strings.TrimSuffix(a.recType, "Array")
+		}
+		indent := "\t"
+		for k := a.dims; k >= 1; k-- {
+			src := "vo"
+			if k < a.dims {
+				src = fmt.Sprintf("v%d", k+1)
+			}
+			ff("%sfor _, v%d := range %s {\n", indent, k, src)
+			indent += "\t"
+			if k > 1 {
+				ff("%slengths[%d] = int32(len(v%d))\n", indent, a.dims-k+1, k)
+			}
+		}
+		ff("%svar f %s\n", indent, elemRecType)
+		ff("%s%s\n", indent, a.elem.setPresent("f"))
+		ff("%s%s\n", indent, a.elem.toRecord("f", "v1", "return "+a.recType+"{}, err"))
+		ff("%sa.Elements = append(a.Elements, f)\n", indent)
+		for k := 1; k <= a.dims; k++ {
+			indent = indent[1:]
+			ff("%s}\n", indent)
+		}
+		ff(`	if len(a.Elements) > 0 {
+		for _, n := range lengths {
+			a.%s = append(a.%s, %s{Length: n, LowerBound: 1})
+		}
+	}
+	return a%s
+}
+
+`, a.dimsField(), a.dimsField(), a.dimType(), noErr)
+	}
+	//-------------------------------------
+}
+
+// genTextArray - an array type holding elements of the given Rec type, read
+// and written in the text format. Used where pgtype has no matching array
+func genTextArray(name string, elemRecType string) {
+	ff(`// %s - pgtype compatible array of %s, read and written in text format
+type %s struct {
+	Elements   []%s
+	Dimensions []pgtype.ArrayDimension
+	Status     pgtype.Status
+}
+
+// DecodeText - implements pgtype.TextDecoder
+func (a *%s) DecodeText(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		*a = %s{Status: pgtype.Null}
+		return nil
+	}
+	uta, err := pgtype.ParseUntypedTextArray(string(src))
+	if err != nil {
+		return err
+	}
+	elements := make([]%s, len(uta.Elements))
+	for i, s := range uta.Elements {
+		var elemSrc []byte
+		if s != "NULL" {
+			elemSrc = []byte(s)
+		}
+		if err = elements[i].DecodeText(ci, elemSrc); err != nil {
+			return err
+		}
+	}
+	*a = %s{Elements: elements, Dimensions: uta.Dimensions, Status: pgtype.Present}
+	return nil
+}
+
+// EncodeText - implements pgtype.TextEncoder
+func (a %s) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	if a.Status != pgtype.Present {
+		return nil, nil
+	}
+	if len(a.Dimensions) == 0 {
+		return append(buf, '{', '}'), nil
+	}
+	buf = pgtype.EncodeTextArrayDimensions(buf, a.Dimensions)
+	// counts[i] - number of elements in one sub array of dimension i
+	counts := make([]int, len(a.Dimensions))
+	counts[len(counts)-1] = int(a.Dimensions[len(counts)-1].Length)
+	for i := len(counts) - 2; i >= 0; i-- {
+		counts[i] = int(a.Dimensions[i].Length) * counts[i+1]
+	}
+	for i, elem := range a.Elements {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		for _, n := range counts {
+			if i%%n == 0 {
+				buf = append(buf, '{')
+			}
+		}
+		elemBuf, err := elem.EncodeText(ci, []byte{})
+		if err != nil {
+			return nil, err
+		}
+		if elemBuf == nil {
+			buf = append(buf, "NULL"...)
+		} else {
+			buf = append(buf, pgtype.QuoteArrayElementIfNeeded(string(elemBuf))...)
+		}
+		for _, n := range counts {
+			if (i+1)%%n == 0 {
+				buf = append(buf, '}')
+			}
+		}
+	}
+	return buf, nil
+}
+
+`, name, elemRecType, name, elemRecType, name, name, elemRecType, name, name)
+}
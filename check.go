@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checkCode - compares the generated files with the files in the package
+// directory. Prints a unified diff for every file that differs or is
+// missing, and lists the orphan files, generated earlier for tables and
+// queries that are no longer generated. Returns true if all is up to date
+func checkCode(dir string, files []generatedFile) bool {
+	upToDate := true
+	generated := map[string]bool{}
+	for _, f := range files {
+		generated[f.name] = true
+		fileName := filepath.Join(dir, f.name)
+		onDisk, err := ioutil.ReadFile(fileName)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println("***ERROR***", "Reading", fileName, "Error =", err)
+			upToDate = false
+			continue
+		}
+		if bytes.Equal(onDisk, f.src) {
+			continue
+		}
+		upToDate = false
+		diskName := fileName
+		if os.IsNotExist(err) {
+			fmt.Println("***ERROR***", "Missing file", fileName)
+			diskName = "/dev/null"
+		} else {
+			fmt.Println("***ERROR***", "Stale file", fileName)
+		}
+		fmt.Print(unifiedDiff(diskName, fileName+" (generated)", string(onDisk), string(f.src)))
+	}
+
+	orphans := []string{}
+	entries, _ := ioutil.ReadDir(dir)
+	for _, e := range entries {
+		if !e.IsDir() && !generated[e.Name()] && isGeneratedFile(filepath.Join(dir, e.Name())) {
+			orphans = append(orphans, e.Name())
+		}
+	}
+	sort.Strings(orphans)
+	for _, name := range orphans {
+		fmt.Println("***ERROR***", "Orphan file", filepath.Join(dir, name),
+			"is no longer generated, its table or query may have been dropped")
+		upToDate = false
+	}
+	return upToDate
+}
+
+// isGeneratedFile - tells whether the file was written by pgx-daogen, by its
+// generated code header
+func isGeneratedFile(fileName string) bool {
+	if !strings.HasSuffix(fileName, ".go") {
+		return false
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	return strings.HasPrefix(line, "// Code generated by pgx-daogen ")
+}
+
+// diffContext - lines of context around the changes of a unified diff
+const diffContext = 3
+
+// unifiedDiff - the changes from a to b in unified diff format, "" if they
+// are the same
+func unifiedDiff(aName string, bName string, a string, b string) string {
+	if a == b {
+		return ""
+	}
+	aLines := splitLines(a)
+	bLines := splitLines(b)
+
+	// Lines in common at the start and the end are skipped before the
+	// longest common subsequence is worked out for the rest
+	pre := 0
+	for pre < len(aLines) && pre < len(bLines) && aLines[pre] == bLines[pre] {
+		pre++
+	}
+	post := 0
+	for post < len(aLines)-pre && post < len(bLines)-pre &&
+		aLines[len(aLines)-1-post] == bLines[len(bLines)-1-post] {
+		post++
+	}
+	am := aLines[pre : len(aLines)-post]
+	bm := bLines[pre : len(bLines)-post]
+	lcs := make([][]int32, len(am)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(bm)+1)
+	}
+	for i := len(am) - 1; i >= 0; i-- {
+		for j := len(bm) - 1; j >= 0; j-- {
+			if am[i] == bm[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// The edit script, one entry per line: ' ' kept, '-' removed, '+' added
+	type edit struct {
+		op   byte
+		text string
+		aPos int
+		bPos int
+	}
+	edits := []edit{}
+	for i := 0; i < pre; i++ {
+		edits = append(edits, edit{' ', aLines[i], i, i})
+	}
+	i, j := 0, 0
+	for i < len(am) || j < len(bm) {
+		switch {
+		case i < len(am) && j < len(bm) && am[i] == bm[j]:
+			edits = append(edits, edit{' ', am[i], pre + i, pre + j})
+			i++
+			j++
+		case i < len(am) && (j == len(bm) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', am[i], pre + i, pre + j})
+			i++
+		default:
+			edits = append(edits, edit{'+', bm[j], pre + i, pre + j})
+			j++
+		}
+	}
+	for k := 0; k < post; k++ {
+		edits = append(edits, edit{' ', aLines[len(aLines)-post+k], len(aLines) - post + k,
+			len(bLines) - post + k})
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+		// A hunk runs from the first change to the last change followed by
+		// no other change within twice the context
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		last := start
+		for k := start; k < len(edits) && k <= last+2*diffContext; k++ {
+			if edits[k].op != ' ' {
+				last = k
+			}
+		}
+		end := last + diffContext + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+		aCount, bCount := 0, 0
+		for _, e := range edits[first:end] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(edits[first].aPos, aCount),
+			hunkRange(edits[first].bPos, bCount))
+		for _, e := range edits[first:end] {
+			fmt.Fprintf(&out, "%c%s\n", e.op, e.text)
+		}
+		start = end
+	}
+	return out.String()
+}
+
+// hunkRange - the line range of a hunk, 1 based as in diff -u
+func hunkRange(pos int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", pos)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", pos+1)
+	}
+	return fmt.Sprintf("%d,%d", pos+1, count)
+}
+
+// splitLines - the lines of the text, without a final empty line
+func splitLines(text string) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"unicode"
 
 	"github.com/jackc/pgx/pgtype"
 )
@@ -24,17 +25,74 @@ type GoColInfo struct {
 	nullValue    string
 	pgValueField string
 	pgTypeCast   string
+	enum         *EnumDesc
+	composite    *CompositeDesc
+	domain       *DomainDesc
+	array        *ArrayInfo
+	textCoded    bool
+	unknownType  string
+	override     *TypeOverride
+	nullMode     string
+	inner        *GoColInfo
+	tag          string
+	isJSON       bool
+	target       string
+	pgOID        string
+	unsupported  string
+	pgxRecType   string
+	nullable     bool
 }
 
 type ColDesc struct {
-	TableSchema   string
-	TableName     string
-	ColumnName    string
-	DataType      string
-	ColumnDefault string
-	Constraints   string
-	IsNullable    bool
-	goInfo        GoColInfo
+	TableSchema     string
+	TableName       string
+	ColumnName      string
+	DataType        string
+	ColumnDefault   string
+	Constraints     string
+	IsNullable      bool
+	OrdinalPosition int
+	TypeOID         uint32
+	TypeMod         int32
+	TypeName        string
+	TypeSchema      string
+	TypeKind        string
+	ElemTypeOID     uint32
+	Dimensions      int
+	IsIdentity      bool
+	IsGenerated     bool
+	Keys            []ColKey
+	goInfo          GoColInfo
+}
+
+// ColKey - membership of a column in a PRIMARY KEY, UNIQUE or FOREIGN KEY
+// constraint. Position is the 1 based position within a composite key
+type ColKey struct {
+	Constraint string
+	Type       string
+	Position   int
+}
+
+// ConstraintDesc - a table constraint as read from pg_constraint
+type ConstraintDesc struct {
+	Name       string
+	Type       string
+	Columns    []string
+	RefSchema  string
+	RefTable   string
+	RefColumns []string
+	Definition string
+}
+
+// IndexDesc - an index as read from pg_index. Expression columns have an
+// empty name
+type IndexDesc struct {
+	Name      string
+	Method    string
+	IsUnique  bool
+	IsPrimary bool
+	IsPartial bool
+	Columns   []string
 }
 
 type ColSummary struct {
@@ -46,42 +104,60 @@ type ColSummary struct {
 }
 
 type TableMap struct {
+	TableSchema    string
+	TableName      string
+	Kind           string
 	colDesc        []ColDesc
 	colSummary     ColSummary
+	Constraints    []ConstraintDesc
+	Indexes        []IndexDesc
 	Sequencename   string
 	Sequenceprefix string
 	HasTime        bool
 	HasVersion     bool
+	references     []*Relation
+	referencedBy   []*Relation
+	lastAttnum     int // attnum of the last column added by DDL, dropped ones included
 }
 
+// typeMap - go type information by information_schema data type. Types
+// pgtype has no type for use GenericText, which is always sent as text. The
+// entries marked textCoded carry their value in the VO as the postgres text
+// representation, converted by the EncodeText and DecodeText of the Rec
 var typeMap = map[string]GoColInfo{
-	"character": GoColInfo{
+	"character varying": GoColInfo{
 		voType:       "string",
 		recType:      "pgtype.Varchar",
 		nullValue:    `""`,
 		pgValueField: "String",
 		pgTypeCast:   "string(",
 	},
-	"text": GoColInfo{
+	"character": GoColInfo{
 		voType:       "string",
-		recType:      "pgtype.Text",
+		recType:      "pgtype.BPChar",
 		nullValue:    `""`,
 		pgValueField: "String",
 		pgTypeCast:   "string(",
 	},
-	"time": GoColInfo{
+	"text": GoColInfo{
 		voType:       "string",
-		recType:      "pgtype.Timestamptz",
+		recType:      "pgtype.Text",
 		nullValue:    `""`,
-		pgValueField: "Time",
-		pgTypeCast:   "time.Parse(time.RFC3339,",
+		pgValueField: "String",
+		pgTypeCast:   "string(",
 	},
-	"date": GoColInfo{
+	"name": GoColInfo{
 		voType:       "string",
-		recType:      "pgtype.Timestamptz",
+		recType:      "pgtype.Name",
 		nullValue:    `""`,
-		pgValueField: "Time",
-		pgTypeCast:   "time.Parse(time.RFC3339,",
+		pgValueField: "String",
+		pgTypeCast:   "string(",
+	},
+	"\"char\"": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.QChar",
+		nullValue: `""`,
+		textCoded: true,
 	},
 	"boolean": GoColInfo{
 		voType:       "bool",
@@ -90,6 +166,13 @@ var typeMap = map[string]GoColInfo{
 		pgValueField: "Bool",
 		pgTypeCast:   "bool(",
 	},
+	"smallint": GoColInfo{
+		voType:       "int16",
+		recType:      "pgtype.Int2",
+		nullValue:    "-1",
+		pgValueField: "Int",
+		pgTypeCast:   "int16(",
+	},
 	"integer": GoColInfo{
 		voType:       "int",
 		recType:      "pgtype.Int4",
@@ -104,6 +187,40 @@ var typeMap = map[string]GoColInfo{
 		pgValueField: "Int",
 		pgTypeCast:   "int64(",
 	},
+	"oid": GoColInfo{
+		voType:       "uint32",
+		recType:      "pgtype.OIDValue",
+		nullValue:    "0",
+		pgValueField: "Uint",
+		pgTypeCast:   "uint32(",
+	},
+	"real": GoColInfo{
+		voType:       "float32",
+		recType:      "pgtype.Float4",
+		nullValue:    "-1",
+		pgValueField: "Float",
+		pgTypeCast:   "float32(",
+	},
+	"double precision": GoColInfo{
+		voType:       "float64",
+		recType:      "pgtype.Float8",
+		nullValue:    "-1",
+		pgValueField: "Float",
+		pgTypeCast:   "float64(",
+	},
+	"numeric": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Numeric",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"money": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.GenericText",
+		nullValue:    `""`,
+		pgValueField: "String",
+		pgTypeCast:   "string(",
+	},
 	"bytea": GoColInfo{
 		voType:       "[]byte",
 		recType:      "pgtype.Bytea",
@@ -111,115 +228,746 @@ var typeMap = map[string]GoColInfo{
 		pgValueField: "Bytes",
 		pgTypeCast:   "[]byte(",
 	},
+	"json": GoColInfo{
+		voType:       "[]byte",
+		recType:      "pgtype.JSON",
+		nullValue:    "[]byte{}",
+		pgValueField: "Bytes",
+		pgTypeCast:   "[]byte(",
+		isJSON:       true,
+	},
 	"jsonb": GoColInfo{
 		voType:       "[]byte",
 		recType:      "pgtype.JSONB",
 		nullValue:    "[]byte{}",
 		pgValueField: "Bytes",
 		pgTypeCast:   "[]byte(",
+		isJSON:       true,
+	},
+	"xml": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.GenericText",
+		nullValue:    `""`,
+		pgValueField: "String",
+		pgTypeCast:   "string(",
+	},
+	"uuid": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.UUID",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"inet": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Inet",
+		nullValue: `""`,
+		textCoded: true,
 	},
+	"cidr": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.CIDR",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"macaddr": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Macaddr",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"macaddr8": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.GenericText",
+		nullValue:    `""`,
+		pgValueField: "String",
+		pgTypeCast:   "string(",
+	},
+	"interval": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Interval",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"date": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.Date",
+		nullValue:    `""`,
+		pgValueField: "Time",
+	},
+	"timestamp without time zone": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.Timestamp",
+		nullValue:    `""`,
+		pgValueField: "Time",
+	},
+	"timestamp with time zone": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.Timestamptz",
+		nullValue:    `""`,
+		pgValueField: "Time",
+	},
+	"time without time zone": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.GenericText",
+		nullValue:    `""`,
+		pgValueField: "String",
+		pgTypeCast:   "string(",
+	},
+	"time with time zone": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.GenericText",
+		nullValue:    `""`,
+		pgValueField: "String",
+		pgTypeCast:   "string(",
+	},
+	"bit": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.GenericText",
+		nullValue:    `""`,
+		pgValueField: "String",
+		pgTypeCast:   "string(",
+	},
+	"bit varying": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Varbit",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"point": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Point",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"line": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Line",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"lseg": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Lseg",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"box": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Box",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"path": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Path",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"polygon": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Polygon",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"circle": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Circle",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"tsvector": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.GenericText",
+		nullValue:    `""`,
+		pgValueField: "String",
+		pgTypeCast:   "string(",
+	},
+	"tsquery": GoColInfo{
+		voType:       "string",
+		recType:      "pgtype.GenericText",
+		nullValue:    `""`,
+		pgValueField: "String",
+		pgTypeCast:   "string(",
+	},
+	"int4range": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Int4range",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"int8range": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Int8range",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"numrange": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Numrange",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"daterange": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Daterange",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"tsrange": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Tsrange",
+		nullValue: `""`,
+		textCoded: true,
+	},
+	"tstzrange": GoColInfo{
+		voType:    "string",
+		recType:   "pgtype.Tstzrange",
+		nullValue: `""`,
+		textCoded: true,
+	},
+}
+
+// unknownColInfo - go type information for types without a mapping. The
+// value is kept in its postgres text form
+var unknownColInfo = GoColInfo{
+	voType:       "string",
+	recType:      "pgtype.GenericText",
+	nullValue:    `""`,
+	pgValueField: "String",
+	pgTypeCast:   "string(",
 }
 
-func getGoColInfo(colType string) GoColInfo {
-	for k, v := range typeMap {
-		//fmt.Println ("coltype=", colType, "k=", k)
-		if strings.HasPrefix(colType, k) {
-			return v
+// getGoColInfo - go type information for a built in column type, resolved by
+// exact match (see lookupColType). Types without a mapping use unknownColInfo
+// and have unknownType set, to be reported by the caller
+func getGoColInfo(col *ColDesc) GoColInfo {
+	if bt := lookupColType(col); bt != nil {
+		return typeMap[bt.dataType]
+	}
+	info := unknownColInfo
+	info.unknownType = col.DataType
+	if len(col.TypeName) > 0 {
+		info.unknownType = col.TypeName
+	}
+	return info
+}
+
+// unresolvedType - name of the type without a mapping used by the column,
+// directly or as array element, or "" if all of its types are known
+func (g *GoColInfo) unresolvedType() string {
+	if g.array != nil {
+		return g.array.elem.unresolvedType()
+	}
+	return g.unknownType
+}
+
+// nullVO - go expression for the VO value of a NULL
+func (g *GoColInfo) nullVO() string {
+	if g.inner != nil {
+		return g.nullableVO()
+	}
+	if g.override != nil {
+		return g.nullValue
+	}
+	return fmt.Sprintf("%s(%s)", g.voType, g.nullValue)
+}
+
+// fromRecord - go expression converting the pgtype value rec to the VO type.
+// If fromFails the expression gives the VO value and an error, use readVO
+func (g *GoColInfo) fromRecord(rec string) string {
+	if g.inner != nil {
+		return g.nullableFromRecord(rec)
+	}
+	if g.override != nil {
+		if len(g.target) > 0 {
+			return fmt.Sprintf("%s(%s.String)", g.overrideFunc("From"), rec)
 		}
+		return fmt.Sprintf("%s(&%s)", g.overrideFunc("From"), rec)
+	}
+	if g.array != nil {
+		return fmt.Sprintf("%s(%s)", g.array.toVOFunc(), rec)
+	}
+	if g.textCoded {
+		if len(g.target) > 0 {
+			return g.pgx5FromText(rec)
+		}
+		return fmt.Sprintf("daogenEncodeText(&%s)", rec)
+	}
+	if g.pgValueField == "Time" {
+		return g.timeFromRecord(rec)
 	}
-	v := typeMap["character"]
-	return v
+	return fmt.Sprintf("%s(%s.%s)", g.voType, rec, g.pgValueField)
 }
 
-func CreateNewTablemap() *TableMap {
+// readVO - statement setting dst to the VO value of the pgtype value rec,
+// which is not NULL. fail is the statement run, with err set, if the value
+// can not be converted
+func (g *GoColInfo) readVO(rec string, dst string, fail string) string {
+	if !g.fromFails() {
+		return fmt.Sprintf("%s = %s", dst, g.fromRecord(rec))
+	}
+	v, base := "v", g
+	if g.inner != nil {
+		v, base = g.nullableFromValue("v"), g.inner
+	}
+	return fmt.Sprintf("if v, err := %s; err != nil { %s } else { %s = %s }",
+		base.fromRecord(rec), fail, dst, v)
+}
+
+// fromFails - true if the conversion of fromRecord can fail, which is the
+// case for type overrides, types converted through their text form and
+// arrays of them
+func (g *GoColInfo) fromFails() bool {
+	switch {
+	case g.inner != nil:
+		return g.inner.fromFails()
+	case g.override != nil:
+		return true
+	case g.array != nil:
+		return g.array.toVOFails()
+	}
+	return g.textEncoded()
+}
+
+// textEncoded - true if the value is converted to and from its text form by
+// pgtype, and not just held as a string
+func (g *GoColInfo) textEncoded() bool {
+	return g.textCoded && (len(g.target) == 0 || len(g.pgOID) > 0)
+}
+
+// toRecord - statement setting the pgtype value rec from the go expression
+// value. The caller sets the status. fail is the statement run, with err
+// set, if the value can not be converted
+func (g *GoColInfo) toRecord(rec string, value string, fail string) string {
+	if g.inner != nil {
+		return g.nullableToRecord(rec, value, fail)
+	}
+	if g.override != nil {
+		nilCheck := ""
+		if strings.HasPrefix(g.voType, "*") {
+			nilCheck = fmt.Sprintf("if %s == nil { %s } else ", value, g.setNull(rec))
+		}
+		return fmt.Sprintf("%sif err := %s(%s, &%s); err != nil { %s }",
+			nilCheck, g.overrideFunc("To"), value, rec, fail)
+	}
+	if g.array != nil {
+		if g.toFails() {
+			return fmt.Sprintf("if a, err := %s(%s); err != nil { %s } else { %s = a }",
+				g.array.fromVOFunc(), value, fail, rec)
+		}
+		return fmt.Sprintf("%s = %s(%s)", rec, g.array.fromVOFunc(), value)
+	}
+	if g.textCoded {
+		if len(g.target) > 0 {
+			return g.pgx5ToText(rec, value, fail)
+		}
+		decode := fmt.Sprintf("if err := %s.DecodeText(nil, []byte(%s)); err != nil { %s }",
+			rec, value, fail)
+		if !g.nullable {
+			return decode
+		}
+		return fmt.Sprintf(`if %s == "" { %s } else %s`, value, g.setNull(rec), decode)
+	}
+	if g.pgValueField == "Time" {
+		return g.timeToRecord(rec, value, fail)
+	}
+	return fmt.Sprintf("%s.%s = %s%s)", rec, g.pgValueField, g.pgTypeCast, value)
+}
+
+// toFails - true if the conversion of toRecord can fail, which is the case
+// for type overrides, VO strings holding a time or the text form of a
+// value, and arrays of them
+func (g *GoColInfo) toFails() bool {
+	switch {
+	case g.inner != nil:
+		return g.inner.toFails()
+	case g.override != nil:
+		return true
+	case g.array != nil:
+		return g.array.elem.toFails()
+	case g.textCoded:
+		return g.textEncoded()
+	}
+	return g.pgValueField == "Time" && g.voType != "time.Time"
+}
+
+// isPresent - go condition true if the Rec value rec is not NULL. The pgx v3
+// types have a Status, the pgx v5 and database/sql types a Valid field
+func (g *GoColInfo) isPresent(rec string) string {
+	if len(g.target) > 0 {
+		return rec + ".Valid"
+	}
+	return rec + ".Status == pgtype.Present"
+}
+
+// setPresent - statement marking the Rec value rec as not NULL
+func (g *GoColInfo) setPresent(rec string) string {
+	if len(g.target) > 0 {
+		return rec + ".Valid = true"
+	}
+	return rec + ".Status = pgtype.Present"
+}
+
+// setNull - statement marking the Rec value rec as NULL
+func (g *GoColInfo) setNull(rec string) string {
+	if len(g.target) > 0 {
+		return rec + ".Valid = false"
+	}
+	return rec + ".Status = pgtype.Null"
+}
+
+// baseRecType - the pgx v3 Rec type of the column, which tells the time
+// types apart where database/sql has a single one
+func (g *GoColInfo) baseRecType() string {
+	if len(g.pgxRecType) > 0 {
+		return g.pgxRecType
+	}
+	return g.recType
+}
+
+// QualifiedName - schema qualified table name, which keys the tables
+func (m *TableMap) QualifiedName() string {
+	return m.TableSchema + "." + m.TableName
+}
+
+// SQLName - schema qualified table name as used in the generated SQL, with
+// the parts quoted where needed
+func (m *TableMap) SQLName() string {
+	return quoteIdent(m.TableSchema) + "." + quoteIdent(m.TableName)
+}
+
+// GoName - name used for the generated types. Tables outside the public
+// schema are prefixed with the schema name so that they cannot collide
+func (m *TableMap) GoName() string {
+	if m.TableSchema == "public" {
+		return convertCase(m.TableName)
+	}
+	return convertCase(m.TableSchema) + convertCase(m.TableName)
+}
+
+// FileName - name of the generated recordset file. Characters that do not
+// belong in a file name are replaced by underscores
+func (m *TableMap) FileName() string {
+	name := m.TableSchema + "_" + m.TableName
+	if m.TableSchema == "public" {
+		name = m.TableName
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name) + "Recordset.go"
+}
+
+// IsReadOnly - views and materialized views only get the select API
+func (m *TableMap) IsReadOnly() bool {
+	return m.Kind == "view" || m.Kind == "matview"
+}
+
+func CreateNewTablemap(schema string, table string) *TableMap {
 	m := TableMap{}
+	m.TableSchema = schema
+	m.TableName = table
+	m.Kind = "table"
 	m.colDesc = make([]ColDesc, 0)
+	m.Constraints = make([]ConstraintDesc, 0)
+	m.Indexes = make([]IndexDesc, 0)
+	m.resetColSummary()
+	return &m
+}
+
+func (m *TableMap) resetColSummary() {
 	m.colSummary = ColSummary{}
 	m.colSummary.insertCols = make([]int, 0)
 	m.colSummary.primaryCols = make([]int, 0)
 	m.colSummary.returningCols = make([]int, 0)
 	m.colSummary.selectCols = make([]int, 0)
 	m.colSummary.updateCols = make([]int, 0)
-	return &m
+	m.HasTime = false
+	m.HasVersion = false
+}
+
+// addConstraint - records the constraint and the key membership of each of
+// its columns
+func (m *TableMap) addConstraint(con ConstraintDesc) {
+	m.Constraints = append(m.Constraints, con)
+	if con.Type == "CHECK" {
+		return
+	}
+	for pos, colName := range con.Columns {
+		for i := range m.colDesc {
+			if m.colDesc[i].ColumnName == colName {
+				m.colDesc[i].Keys = append(m.colDesc[i].Keys,
+					ColKey{Constraint: con.Name, Type: con.Type, Position: pos + 1})
+			}
+		}
+	}
+}
+
+func (m *TableMap) primaryKey() *ConstraintDesc {
+	for i := range m.Constraints {
+		if m.Constraints[i].Type == "PRIMARY KEY" {
+			return &m.Constraints[i]
+		}
+	}
+	return nil
+}
+
+func (m *TableMap) colIndex(colName string) int {
+	for i, col := range m.colDesc {
+		if col.ColumnName == colName {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *ColDesc) isPrimary() bool {
+	for _, k := range c.Keys {
+		if k.Type == "PRIMARY KEY" {
+			return true
+		}
+	}
+	return false
+}
+
+// buildColSummary - works out the go types of all columns and the column
+// lists used for select, insert, update and returning. To be called once all
+// columns and constraints of the table are known
+func (m *TableMap) buildColSummary(meta *DBMeta) {
+	m.resetColSummary()
+	if pk := m.primaryKey(); pk != nil {
+		for _, colName := range pk.Columns {
+			if i := m.colIndex(colName); i >= 0 {
+				m.colSummary.primaryCols = append(m.colSummary.primaryCols, i)
+			}
+		}
+	}
+	for i := range m.colDesc {
+		col := &m.colDesc[i]
+		keyTypes := []string{}
+		for _, k := range col.Keys {
+			keyTypes = append(keyTypes, k.Type)
+		}
+		col.Constraints = strings.Join(keyTypes, ",")
+		hasDefault := len(col.ColumnDefault) > 0 || col.IsIdentity
+		col.goInfo = meta.goColInfo(col)
+		col.goInfo.goColName = convertCase(col.ColumnName)
+		col.goInfo = meta.nullableColInfo(col)
+		col.goInfo.tag = meta.voTag(m.TableSchema, m.TableName, col, m.Constraints)
+		if col.goInfo.pgValueField == "Time" {
+			m.HasTime = true
+		}
+		if col.ColumnName == "version" {
+			m.HasVersion = true
+		}
+		m.colSummary.selectCols = append(m.colSummary.selectCols, i)
+		if !col.isPrimary() && !col.IsGenerated {
+			m.colSummary.updateCols = append(m.colSummary.updateCols, i)
+		}
+		if !hasDefault && !col.IsGenerated {
+			m.colSummary.insertCols = append(m.colSummary.insertCols, i)
+		}
+		if hasDefault || col.IsGenerated || col.isPrimary() {
+			m.colSummary.returningCols = append(m.colSummary.returningCols, i)
+		}
+	}
+}
+
+var constraintTypes = map[string]string{
+	"p": "PRIMARY KEY",
+	"u": "UNIQUE",
+	"f": "FOREIGN KEY",
+	"c": "CHECK",
 }
-func ProcessColMetadata(db *DBase) map[string]*TableMap {
-	//db, err := CreateConnection("localhost", dbname, username, password, numconns)
+
+// ProcessColMetadata - reads the column metadata of all tables in the given
+// schemas from pg_catalog. The returned map is keyed by the schema qualified
+// table name. The go types are only worked out by DBMeta.prepare
+func ProcessColMetadata(db *DBase, schemas []string) map[string]*TableMap {
 	conn := db.ConnPool
 	tableMap := make(map[string]*TableMap, 0)
+
+	//=========   Columns   ===========
 	rows, err := conn.Query(`
-		select c.table_schema,c.table_name,c.column_name,c.data_type, 
-		c.column_default,c.is_nullable::bool, 
-			(select array_to_string(array_agg(tc.constraint_type::text),',') from 
-			information_schema.key_column_usage kc join information_schema.table_constraints tc on 
-			kc.constraint_name = tc.constraint_name 
-			where kc.table_schema=c.table_schema and kc.table_name=c.table_name 
-			and kc.column_name=c.column_name) 
-		 as constraints 
-		from information_schema.columns c where c.table_schema = 'public' 
-		order by c.table_name,c.ordinal_position
-		`)
+		select n.nspname, c.relname, c.relkind::text, a.attnum, a.attname,
+			case when t.typcategory = 'A' then 'ARRAY'
+				when t.typtype = 'd' then format_type(t.typbasetype, null)
+				when t.typtype in ('e', 'c') then 'USER-DEFINED'
+				else format_type(a.atttypid, null) end,
+			a.atttypid, a.atttypmod, t.typname, tn.nspname, t.typtype::text, t.typelem,
+			a.attndims, pg_get_expr(d.adbin, d.adrelid), not a.attnotnull,
+			a.attidentity <> '', a.attgenerated <> ''
+		from pg_attribute a
+		join pg_class c on c.oid = a.attrelid
+		join pg_namespace n on n.oid = c.relnamespace
+		join pg_type t on t.oid = a.atttypid
+		join pg_namespace tn on tn.oid = t.typnamespace
+		left join pg_attrdef d on d.adrelid = a.attrelid and d.adnum = a.attnum
+		where n.nspname = any($1) and c.relkind in ('r', 'p', 'v', 'm', 'f')
+		and not c.relispartition and a.attnum > 0 and not a.attisdropped
+		order by n.nspname, c.relname, a.attnum
+		`, schemas)
 	if err != nil {
-		fmt.Println("***ERROR*** : Reading information schema. Error = ", err)
+		fmt.Println("***ERROR*** : Reading pg_attribute. Error = ", err)
 		return nil
 	}
-	//fmt.Println("Error returned:", err)
-	defer rows.Close()
-
-	columnNum := 0
 	for rows.Next() {
 		trec := ColDesc{}
-
-		var columnDefaultVC, constraintsVC pgtype.Varchar
-
-		err := rows.Scan(&trec.TableSchema, &trec.TableName, &trec.ColumnName,
-			&trec.DataType, &columnDefaultVC, &trec.IsNullable, &constraintsVC)
+		var relKind string
+		var typeOID, elemOID pgtype.OID
+		var columnDefaultVC pgtype.Varchar
+		err := rows.Scan(&trec.TableSchema, &trec.TableName, &relKind, &trec.OrdinalPosition,
+			&trec.ColumnName, &trec.DataType, &typeOID, &trec.TypeMod, &trec.TypeName,
+			&trec.TypeSchema, &trec.TypeKind, &elemOID, &trec.Dimensions, &columnDefaultVC,
+			&trec.IsNullable, &trec.IsIdentity, &trec.IsGenerated)
 		if err != nil {
+			rows.Close()
 			fmt.Println("***ERROR***", "Generate", err)
 			return nil
 		}
-		trec.goInfo = getGoColInfo(trec.DataType)
-		trec.goInfo.goColName = convertCase(trec.ColumnName)
+		trec.TypeOID = uint32(typeOID)
+		trec.ElemTypeOID = uint32(elemOID)
 		trec.ColumnDefault = ""
 		if columnDefaultVC.Status == pgtype.Present {
 			trec.ColumnDefault = columnDefaultVC.String
 		}
-		trec.Constraints = ""
-		if constraintsVC.Status == pgtype.Present {
-			trec.Constraints = constraintsVC.String
+		key := trec.TableSchema + "." + trec.TableName
+		mp, ok := tableMap[key]
+		if !ok {
+			mp = CreateNewTablemap(trec.TableSchema, trec.TableName)
+			switch relKind {
+			case "v":
+				mp.Kind = "view"
+			case "m":
+				mp.Kind = "matview"
+			}
+			tableMap[key] = mp
 		}
+		mp.colDesc = append(mp.colDesc, trec)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		fmt.Println("***ERROR*** : Reading pg_attribute. Error = ", err)
+		return nil
+	}
 
-		/*fmt.Println(trec.TableName, ",", trec.ColumnName, ",", trec.DataType, ",",
-		trec.ColumnDefault, ",", trec.Constraints, ",", trec.IsNullable)*/
-		if _, ok := tableMap[trec.TableName]; !ok {
-			tableMap[trec.TableName] = CreateNewTablemap()
-			err = conn.QueryRow("select sequence_name, constant_prefix from seq_constants where list_table = $1", trec.TableName).Scan(&tableMap[trec.TableName].Sequencename, &tableMap[trec.TableName].Sequenceprefix)
-			if err != nil {
-				tableMap[trec.TableName].Sequencename = ""
-				tableMap[trec.TableName].Sequenceprefix = ""
-			}
-			columnNum = 0
+	//=========   Constraints   ===========
+	rows, err = conn.Query(`
+		select n.nspname, c.relname, con.conname, con.contype::text,
+			array(select a.attname::text from unnest(con.conkey) with ordinality k(attnum, ord)
+				join pg_attribute a on a.attrelid = con.conrelid and a.attnum = k.attnum
+				order by k.ord),
+			coalesce(fn.nspname, ''), coalesce(fc.relname, ''),
+			array(select a.attname::text from unnest(con.confkey) with ordinality k(attnum, ord)
+				join pg_attribute a on a.attrelid = con.confrelid and a.attnum = k.attnum
+				order by k.ord),
+			pg_get_constraintdef(con.oid)
+		from pg_constraint con
+		join pg_class c on c.oid = con.conrelid
+		join pg_namespace n on n.oid = c.relnamespace
+		left join pg_class fc on fc.oid = con.confrelid
+		left join pg_namespace fn on fn.oid = fc.relnamespace
+		where n.nspname = any($1) and con.contype in ('p', 'u', 'f', 'c')
+		order by n.nspname, c.relname, con.conname
+		`, schemas)
+	if err != nil {
+		fmt.Println("***ERROR*** : Reading pg_constraint. Error = ", err)
+		return nil
+	}
+	for rows.Next() {
+		var schema, table, conType string
+		con := ConstraintDesc{}
+		err := rows.Scan(&schema, &table, &con.Name, &conType, &con.Columns,
+			&con.RefSchema, &con.RefTable, &con.RefColumns, &con.Definition)
+		if err != nil {
+			rows.Close()
+			fmt.Println("***ERROR***", "Generate", err)
+			return nil
 		}
-		mp := tableMap[trec.TableName]
-		if trec.goInfo.pgValueField == "Time" {
-			mp.HasTime = true
+		con.Type = constraintTypes[conType]
+		if mp, ok := tableMap[schema+"."+table]; ok {
+			mp.addConstraint(con)
 		}
-		if trec.ColumnName == "version" {
-			mp.HasVersion = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		fmt.Println("***ERROR*** : Reading pg_constraint. Error = ", err)
+		return nil
+	}
+
+	//=========   Indexes   ===========
+	rows, err = conn.Query(`
+		select n.nspname, c.relname, i.relname, am.amname, x.indisunique, x.indisprimary,
+			x.indpred is not null,
+			array(select coalesce(a.attname::text, '') from unnest(x.indkey::int2[]) with ordinality k(attnum, ord)
+				left join pg_attribute a on a.attrelid = x.indrelid and a.attnum = k.attnum
+				where k.ord <= x.indnkeyatts order by k.ord)
+		from pg_index x
+		join pg_class c on c.oid = x.indrelid
+		join pg_namespace n on n.oid = c.relnamespace
+		join pg_class i on i.oid = x.indexrelid
+		join pg_am am on am.oid = i.relam
+		where n.nspname = any($1)
+		order by n.nspname, c.relname, i.relname
+		`, schemas)
+	if err != nil {
+		fmt.Println("***ERROR*** : Reading pg_index. Error = ", err)
+		return nil
+	}
+	for rows.Next() {
+		var schema, table string
+		idx := IndexDesc{}
+		err := rows.Scan(&schema, &table, &idx.Name, &idx.Method, &idx.IsUnique,
+			&idx.IsPrimary, &idx.IsPartial, &idx.Columns)
+		if err != nil {
+			rows.Close()
+			fmt.Println("***ERROR***", "Generate", err)
+			return nil
 		}
-		mp.colDesc = append(mp.colDesc, trec)
-		mp.colSummary.selectCols = append(mp.colSummary.selectCols, columnNum)
-		if strings.Contains(trec.Constraints, "PRIMARY") {
-			mp.colSummary.primaryCols = append(mp.colSummary.primaryCols, columnNum)
-		} else {
-			mp.colSummary.updateCols = append(mp.colSummary.updateCols, columnNum)
+		if mp, ok := tableMap[schema+"."+table]; ok {
+			mp.Indexes = append(mp.Indexes, idx)
 		}
-		if len(trec.ColumnDefault) == 0 {
-			mp.colSummary.insertCols = append(mp.colSummary.insertCols, columnNum)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		fmt.Println("***ERROR*** : Reading pg_index. Error = ", err)
+		return nil
+	}
+
+	//=========   Key generation from seq_constants   ===========
+	hasSeqConstants := false
+	err = conn.QueryRow("select to_regclass('seq_constants') is not null").Scan(&hasSeqConstants)
+	if err == nil && hasSeqConstants {
+		rows, err = conn.Query("select list_table, sequence_name, constant_prefix from seq_constants")
+		if err != nil {
+			fmt.Println("***ERROR*** : Reading seq_constants. Error = ", err)
+			return nil
 		}
-		if len(trec.ColumnDefault) > 0 || strings.Contains(trec.Constraints, "PRIMARY") {
-			mp.colSummary.returningCols = append(mp.colSummary.returningCols, columnNum)
+		for rows.Next() {
+			var listTable, sequenceName, sequencePrefix string
+			if err := rows.Scan(&listTable, &sequenceName, &sequencePrefix); err != nil {
+				rows.Close()
+				fmt.Println("***ERROR***", "Generate", err)
+				return nil
+			}
+			// seq_constants entries for tables outside public are schema qualified
+			key := listTable
+			if !strings.Contains(listTable, ".") {
+				key = "public." + listTable
+			}
+			if mp, ok := tableMap[key]; ok {
+				mp.Sequencename = sequenceName
+				mp.Sequenceprefix = sequencePrefix
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			fmt.Println("***ERROR*** : Reading seq_constants. Error = ", err)
+			return nil
 		}
-		columnNum++
 	}
+
 	return tableMap
 }
@@ -10,14 +10,71 @@ type QueryInfo struct {
 	Query string
 }
 
+// TypeOverride - maps a postgres type (in Types) or a column (in Columns) to
+// a go type. Type is a built in type name such as numeric, or the name of a
+// user defined type, optionally schema qualified. Column is given as
+// table.column or schema.table.column. Import is the package path of GoType
+// and NullValue the VO value for NULL, by default the zero value of GoType
+type TypeOverride struct {
+	Type      string
+	Column    string
+	GoType    string
+	Import    string
+	NullValue string
+}
+
+// TypeOverrides - the TypeOverrides section of the config file. Column
+// overrides take precedence over type overrides
+type TypeOverrides struct {
+	Types   []TypeOverride
+	Columns []TypeOverride
+}
+
+// TagSet - a struct tag of the VO fields, such as json or db. Naming is the
+// naming strategy of the field names: column (the default, the column name as
+// is), snake_case, camelCase, PascalCase or kebab-case. The validate tag set
+// holds go-playground/validator rules derived from the column metadata
+type TagSet struct {
+	Name      string
+	Naming    string
+	OmitEmpty bool
+}
+
+// ColumnTags - the tag options of a single column, given as table.column,
+// schema.table.column, query.column or type.attribute. Ignore gives "-" in
+// every tag set, Values replaces the value of the named tag sets
+type ColumnTags struct {
+	Column    string
+	OmitEmpty bool
+	Ignore    bool
+	Values    map[string]string
+}
+
+// Tags - the Tags section of the config file
+type Tags struct {
+	Sets    []TagSet
+	Columns []ColumnTags
+}
+
 type Genstruct struct {
-	Hostname    string
-	Dbname      string
-	Username    string
-	Password    string
-	Tables      []string
-	Queries     []QueryInfo
-	PackageName string
+	Hostname      string
+	Dbname        string
+	Username      string
+	Password      string
+	Schemas       []string
+	Tables        []string
+	Queries       []QueryInfo
+	PackageName   string
+	MigrationsDir string
+	StrictTypes   bool
+	TypeOverrides TypeOverrides
+	TimeMode      string
+	TimeZone      string
+	NullMode      string
+	Tags          Tags
+	TemplateDir   string
+	PgxVersion    int
+	Backend       string
 }
 
 func GetGenData(fileName string) *Genstruct {
@@ -31,5 +88,8 @@ func GetGenData(fileName string) *Genstruct {
 	if err != nil {
 		panic(err)
 	}
+	if len(v.Schemas) == 0 {
+		v.Schemas = []string{"public"}
+	}
 	return &v
 }
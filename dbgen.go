@@ -2,461 +2,148 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"text/template"
 )
 
-func generateProgram(tableName string, tableMap *TableMap) {
-	tableName1 := convertCase(tableName)
+// tableData - works out the template data of the table
+func tableData(pkg string, tableMap *TableMap) *TableData {
+	tableName := tableMap.SQLName()
+	tableName1 := tableMap.GoName()
 	cols := tableMap.colDesc
 	colSumm := tableMap.colSummary
-	sequenceName := tableMap.Sequencename
-	sequencePrefix := tableMap.Sequenceprefix
-
-	//=========   Generate the imports ===========
-	{
-		timeImport := ""
-		if tableMap.HasTime {
-			timeImport = `"time"`
-		}
-
-		ff(`import (
-	"errors"
-	"fmt"
-	%s
-
-	"github.com/jackc/pgx"
-	"github.com/jackc/pgx/pgtype"
-)
-`, timeImport)
-	}
-	//-------------------------------------
-
-	//=========   Create the VO type  ===================
-	{
-		ff("// %sVO - Value object format to be used in code\n", tableName1)
-		ff("type %sVO struct {\n", tableName1)
-
-		for _, v := range cols {
-			ff("\t%-30s%s\n", v.goInfo.goColName, v.goInfo.voType)
-		}
-		ff("}\n\n")
-	}
-	//---------------------------------------------
-
-	//==========    Generate the Record type     =================
-	{
-		ff("// %sRec - Record format using native types for database interaction\n", tableName1)
-		ff("type %sRec struct {\n", tableName1)
-		for _, v := range cols {
-			ff("\t%-30s%s\n", v.goInfo.goColName, v.goInfo.recType)
-		}
-		ff("}\n\n")
-	}
-	//--------------------------------------------------
-
-	//==============   Generate the main table type   ===============
-	{
-		ff("// %sTable - the primary table object\n", tableName1)
-		ff("type %sTable struct {\n", tableName1)
-		ff("\t%-30s%s\n", "DBconn", "*DBase")
-		ff("\t%-30s%sRec\n", "Record", tableName1)
-		ff("\t%-30s%sVO\n", "VO", tableName1)
-		ff("\t%-30s[]%sVO\n", "VOs", tableName1)
-		ff("\t%-30s%s\n", "CurrentRows", "*pgx.Rows")
-		ff("\t%-30s%s\n", "CurrentRow", "*pgx.Row")
-		ff("\t%-30s%s\n", "singleRowSelected", "bool")
-		ff("\t%-30s%s\n", "Statements", "map[string]string")
-		ff("}\n\n")
-	}
-	//---------------------------------------------------
-
-	//==========     Generate NewTable function ==============
-	{
-		ff("//New%s - function to initialize the base struct\n", tableName1)
-		ff(`func New%s(dbconn *DBase) *%sTable {
-	t := %sTable{}
-	t.DBconn = dbconn
-	t.Statements = map[string]string{
-`, tableName1, tableName1, tableName1)
-		s1 := ""
-		s2 := ""
-		s1, s2 = generateSelectStatement(tableName, tableMap)
-		ff("\t\t\"%sSelectAll\": \"%s\",\n", tableName1, s1)
-		ff("\t\t\"%sSelect\": \"%s%s\",\n", tableName1, s1, s2)
-		s1 = generateInsertStatement(tableName, tableMap)
-		ff("\t\t\"%sInsert\": \"%s\",\n", tableName1, s1)
-		s1 = generateUpdateStatement(tableName, tableMap)
-		ff("\t\t\"%sUpdate\": \"%s\",\n", tableName1, s1)
-		ff("\t}\n")
-		ff("\tt.Record = %sRec {}\n", tableName1)
-		ff("\tt.VO = %sVO {}\n", tableName1)
-		ff("\tt.singleRowSelected = false\n")
-		ff("\treturn &t\n")
-		ff("}\n\n")
-	}
-	//-----------------------------------------------------
-
-	//==========     Generate Reinitialize function ==============
-	{
-		ff("//Reinitialize - function to reinitialize the VO and Rec\n")
-		ff(`func (t *%sTable) Reinitialize() {
-`, tableName1)
-		ff("\tt.Record = %sRec {}\n", tableName1)
-		ff("\tt.VO = %sVO {}\n", tableName1)
-		ff("\tt.singleRowSelected = false\n")
-		ff("}\n\n")
-	}
-	//-----------------------------------------------------
-
-	//=========      Generate ScanRecord function    =============
-	{
-		ff("// ScanRecord - Scans the current Row into the Record variable\n")
-		scanRecordList := ""
-		for i, v := range cols {
-			if i > 0 {
-				scanRecordList += ", "
-			}
-			temp := fmt.Sprintf("&t.Record.%s", v.goInfo.goColName)
-			scanRecordList += temp
+	readOnly := tableMap.IsReadOnly()
+
+	data := &TableData{
+		Package:        pkg,
+		Name:           tableName,
+		GoName:         tableName1,
+		Kind:           tableMap.Kind,
+		ReadOnly:       readOnly,
+		HasTime:        tableMap.HasTime,
+		HasVersion:     tableMap.HasVersion,
+		Imports:        overrideImports(cols),
+		PrimaryKey:     columnsData(cols, colSumm.primaryCols),
+		Insert:         columnsData(cols, colSumm.insertCols),
+		Returning:      columnsData(cols, colSumm.returningCols),
+		Sequence:       tableMap.Sequencename,
+		SequencePrefix: tableMap.Sequenceprefix,
+	}
+	for i := range cols {
+		data.Columns = append(data.Columns, columnData(&cols[i]))
+	}
+
+	// The version column is incremented by the statement itself
+	for _, v := range colSumm.updateCols {
+		if cols[v].ColumnName != "version" {
+			data.Update = append(data.Update, columnData(&cols[v]))
 		}
-		ff("func (t *%sTable) ScanRecord() (*%sRec, error) {\n", tableName1, tableName1)
-		ff("\tvar err error\n")
-		ff("\tif t.singleRowSelected {\n")
-		ff("\t\terr = t.CurrentRow.Scan(%s)\n", scanRecordList)
-
-		ff("\t} else {\n\t\terr = t.CurrentRows.Scan(%s)\n\t}\n\treturn &t.Record, err\n}\n\n", scanRecordList)
-
 	}
-	//-------------------------------------------------------
+	data.Update = append(data.Update, data.PrimaryKey...)
 
-	//=============   two functions - PrepareStatement4Key and ExecuteQuery ===========
-	{
-		ff(`// PrepareStatement4Key - Given key, fetches and prepares statement
-func (t *%sTable) PrepareStatement4Key(queryKey string) error {
-	c := t.DBconn.ConnPool
-	if _, ok := t.Statements[queryKey]; !ok {
-		return errors.New("***ERROR*** - ExecuteQuery - Given query key (" + queryKey + ") not found!")
-	}
-	_, err := c.Prepare(queryKey, t.Statements[queryKey])
-	if err != nil {
-		fmt.Println("***ERROR***", "Preparing Select All", err)
-		return err
-	}
-	return nil
-}
-
-// ExecuteQuery - common function to execute given keyed query and return results
-func (t *%sTable) ExecuteQuery(queryKey string, args ...interface{}) error {
-	if err := t.PrepareStatement4Key(queryKey); err != nil {
-		return err
-	}
-	c := t.DBconn.ConnPool
-	if t.CurrentRows != nil {
-		t.CurrentRows.Close()
-	}
-	rows, err := c.Query(queryKey, args...)
-	if err != nil {
-		fmt.Println("***ERROR***", "Query Select All", err)
-		return err
+	// Genkey sets the first key column, or the first column without a key
+	keySubs := 0
+	if len(colSumm.primaryCols) > 0 {
+		keySubs = colSumm.primaryCols[0]
 	}
-	t.CurrentRows = rows
-	return nil
-}
-
-`, tableName1, tableName1)
+	if len(cols) > 0 {
+		data.KeyColumn = columnData(&cols[keySubs])
 	}
-	//---------------------------------------------------------
-
-	//======== Two more - SelectAll and Select
-	{
-		primaryKeyParamList := ""
-		primaryKeyParamList1 := ""
-		{
-			for i, subs := range colSumm.primaryCols {
-				col := cols[subs]
-				if i > 0 {
-					primaryKeyParamList += ", "
-					primaryKeyParamList1 += ", "
-				}
-				temp := fmt.Sprintf("key%d %s", i+1, col.goInfo.voType)
-				primaryKeyParamList += temp
-				temp = fmt.Sprintf("key%d", i+1)
-				primaryKeyParamList1 += temp
-			}
 
+	//======== The statements, keyed by the go name of the table
+	s1, s2 := generateSelectStatement(tableName, tableMap)
+	data.SelectAll = s1
+	data.Statements = append(data.Statements, Statement{tableName1 + "SelectAll", s1})
+	if len(colSumm.primaryCols) > 0 {
+		data.Statements = append(data.Statements, Statement{tableName1 + "Select", s1 + s2})
+	}
+	if !readOnly {
+		data.Statements = append(data.Statements,
+			Statement{tableName1 + "Insert", generateInsertStatement(tableName, tableMap)},
+			Statement{tableName1 + "Update", generateUpdateStatement(tableName, tableMap)})
+		for _, u := range tableUpserts(tableMap) {
+			data.Statements = append(data.Statements, Statement{tableName1 + u.Method,
+				generateUpsertStatement(tableName, tableMap, u.insertCols, u.conflictCols)})
+			data.Upserts = append(data.Upserts, UpsertData{
+				Method: u.Method,
+				Index:  u.Index,
+				Insert: columnsData(cols, u.insertCols),
+			})
 		}
-		ff(`// SelectAll - issues a select on the table. Sets the CurrentRows element
-// to the returned rows. These will now be available via NextRow
-func (t *%sTable) SelectAll() error {
-	return t.ExecuteQuery("%sSelectAll")
-}
-
-// Select - issues a select on the table for key. Sets the CurrentRows element
-// to the returned rows. These will now be available via NextRow
-func (t *%sTable) Select(%s) error {
-	return t.ExecuteQuery("%sSelect", %s)
-}
-
-`, tableName1, tableName1, tableName1, primaryKeyParamList, tableName1, primaryKeyParamList1)
-
-	}
-	//-------------------------------------------------------------
-
-	//============   Generate SelectFor    =======================
-	{
-		ff(`// SelectFor - first param is the WHERE clause without WHERE.
-// Optional arguments can be passed. Sets the CurrentRows element
-// to the returned rows. These will now be available via NextRow
-func (t *%sTable) SelectFor(whereCond string, args ...interface{}) error {
-	c := t.DBconn.ConnPool
-	query := t.Statements["%sSelectAll"]
-	if len(whereCond) > 0 {
-		query += " WHERE "
-		query += whereCond
-	}
-	if t.CurrentRows != nil {
-		t.CurrentRows.Close()
-	}
-	rows, err := c.Query(query, args...)
-	if err != nil {
-		fmt.Println("***ERROR***", "Query SelectFor", err)
-		return err
-	}
-	t.CurrentRows = rows
-	return nil
-}
-
-`, tableName1, tableName1)
-	}
-	//------------------------------------------------------------
-
-	//===== conditionally generate the Genkey function    =============
-	genKeyCallingCode := ""
-	{
-		primaryKeyCol := ""
-		primaryKeySubs := 0
 		if len(colSumm.primaryCols) > 0 {
-			primaryKeySubs = colSumm.primaryCols[0]
-		}
-		primaryKeyCol = cols[primaryKeySubs].goInfo.goColName
-
-		if len(sequenceName) > 0 {
-			ff(`// Genkey - used to generate primary key if entry present in seq_constants
-func (t *%sTable) Genkey() error {
-	c := t.DBconn.ConnPool
-	nextVal := 0
-	err := c.QueryRow("select nextval('%s')").Scan(&nextVal)
-	if err != nil {
-		fmt.Println("*** Scan ***", err)
-		return err
-	}
-	`, tableName1, sequenceName)
-			ff("key := fmt.Sprintf(\"%%s%%04d\", \"%s\", nextVal)\n", sequencePrefix)
-			ff(`	t.VO.%s = key
-	return nil
-}
-
-`, primaryKeyCol)
-			genKeyCallingCode = "t.Genkey()"
-		}
-	}
-	//---------------------------------------------------------------
-
-	//=========== Generate Insert function =========================
-	{
-		assignToVersion := ""
-		if tableMap.HasVersion {
-			assignToVersion = "t.VO.Version = 100"
-		}
-		ff(`// Insert - Used to insert record. The Record struct needs to
-// be filled before calling Insert
-func (t *%sTable) Insert() error {
-	queryKey := "%sInsert"
-	var err error
-	if err = t.PrepareStatement4Key(queryKey); err != nil {
-		fmt.Println(err)
-		return err
-	}
-	c := t.DBconn.ConnPool
-	%s
-	%s
-	t.ConvertVO2Record()
-	r := &t.Record
-`, tableName1, tableName1, genKeyCallingCode, assignToVersion)
-		if len(colSumm.returningCols) > 0 {
-			ff("\trow := c.QueryRow(queryKey")
-		} else {
-			ff("\t_, err = c.Exec(queryKey")
-		}
-		for _, v := range colSumm.insertCols {
-			col := cols[v]
-			temp := fmt.Sprintf(", &r.%s", col.goInfo.goColName)
-			ff(temp)
-		}
-		ff(")\n")
-		if len(colSumm.returningCols) > 0 {
-			ff("\terr = row.Scan(")
-			for i, v := range colSumm.returningCols {
-				col := cols[v]
-				if i > 0 {
-					ff(", ")
-				}
-				ff("&r.%s", col.goInfo.goColName)
+			s1, s2 := generateDeleteStatement(tableName, tableMap)
+			data.Statements = append(data.Statements, Statement{tableName1 + "Delete", s1})
+			if tableMap.HasVersion {
+				data.Statements = append(data.Statements, Statement{tableName1 + "DeleteVersioned", s1 + s2})
 			}
-			ff(")\n")
-
 		}
-		ff("\treturn err\n}\n\n")
+	}
+	for _, f := range tableFinders(tableMap) {
+		data.Statements = append(data.Statements, Statement{tableName1 + f.Method,
+			fmt.Sprintf("%s WHERE %s", s1, whereCond(tableMap, f.cols))})
+		data.Finders = append(data.Finders, FinderData{
+			Method:  f.Method,
+			Index:   f.Index.Name,
+			Unique:  f.Index.IsUnique,
+			Columns: columnsData(cols, f.cols),
+		})
 	}
 	//---------------------------------------------
 
-	//=======   Generate Update function   =======================
-	{
-		// Generate the update function
-		ff(`// Update - Used to update record. The Record struct needs to
-// be filled before calling Update
-func (t *%sTable) Update() error {
-	queryKey := "%sUpdate"
-	if err := t.PrepareStatement4Key(queryKey); err != nil {
-		fmt.Println(err)
-		return err
-	}
-	c := t.DBconn.ConnPool
-	t.ConvertVO2Record()
-	r := t.Record
-`, tableName1, tableName1)
-		ff("\t_, err := c.Exec(queryKey")
-		for _, v := range colSumm.updateCols {
-			if cols[v].ColumnName != "version" {
-				ff(", ")
-				ff("&r.%s", convertCase(cols[v].ColumnName))
-			}
+	//======== Enum columns checked by Validate
+	for _, col := range cols {
+		if col.goInfo.enum == nil {
+			continue
 		}
-		for _, v := range colSumm.primaryCols {
-			ff(", ")
-			ff("&r.%s", convertCase(cols[v].ColumnName))
+		value := "t.VO." + col.goInfo.goColName
+		check := EnumCheck{GoName: col.goInfo.goColName, Value: value, Label: value}
+		switch {
+		case col.goInfo.nullMode == "pointer":
+			check.Cond = value + " != nil && "
+			check.Label = "*" + value
+		case col.goInfo.inner != nil:
+			check.Cond = value + ".Valid && "
+			check.Value += "." + col.goInfo.nullField()
+			check.Label = check.Value
+		case col.IsNullable || len(col.ColumnDefault) > 0:
+			// Insert leaves a defaulted column to its DEFAULT, so it is
+			// only checked when set
+			check.Cond = value + ` != "" && `
 		}
-		ff(")\n\treturn err\n}\n\n")
-	}
-	//----------------------------------------------------------------
-
-	//==============     Generate FetchRows   =====================
-	{
-		ff(`// FetchRecords - Fetches all records into VOs object
-// based on the current CurrentRows
-func (t *%sTable) FetchRecords() []%sVO {
-	t.VOs = []%sVO{}
-	if t.CurrentRows == nil {
-		return t.VOs
+		data.EnumChecks = append(data.EnumChecks, check)
 	}
-	defer t.CurrentRows.Close()
-	for t.NextRow() {
-		v := t.VO
-		t.VOs = append(t.VOs, v)
-	}
-	return t.VOs
-}
+	//---------------------------------------------
 
-`, tableName1, tableName1, tableName1)
+	//======== Foreign key navigation
+	for _, r := range tableMap.references {
+		data.References = append(data.References, RelationData{
+			Method:     r.FetchMethod(),
+			Table:      r.To.QualifiedName(),
+			GoName:     r.To.GoName(),
+			Constraint: r.Constraint.Name,
+			Where:      whereCond(r.To, r.toCols),
+			Columns:    columnsData(cols, r.fromCols),
+		})
+	}
+	for _, r := range tableMap.referencedBy {
+		data.ReferencedBy = append(data.ReferencedBy, RelationData{
+			Method:     r.SelectMethod(),
+			Table:      r.From.QualifiedName(),
+			GoName:     r.From.GoName(),
+			Constraint: r.Constraint.Name,
+			Where:      whereCond(r.From, r.fromCols),
+			Columns:    columnsData(cols, r.toCols),
+		})
 	}
-	//------------------------------------------------------------------
+	//---------------------------------------------
 
-	//================  Generate NextRow function    ===========
-	{
-		// Generate NextRow function
-		ff(`// NextRow - Used to scroll through the contained Rows
-func (t *%sTable) NextRow() bool {
-	if t.CurrentRows != nil {
-		ret := t.CurrentRows.Next()
-		if ret {
-			t.ScanRecord()
-			t.ConvertRecord2VO()
-		}
-		return ret
-	}
-	return false
+	return data
 }
 
-`, tableName1)
-	}
-	//--------------------------------------------------------------
-
-	//=============     Generate ConvertRecord2VO function  ===============
-	{
-		ff(`// ConvertRecord2VO - Convert pgtype types to VO go types
-func (t *%sTable) ConvertRecord2VO() *%sVO {
-`, tableName1, tableName1)
-		for _, v := range cols {
-			toString := ""
-			if v.goInfo.pgValueField == "Time" {
-				toString = ".String()"
-			}
-			ff("\tif t.Record.%s.Status == pgtype.Present {\n", v.goInfo.goColName)
-			ff("\t\tt.VO.%s = %s(t.Record.%s.%s%s)\n",
-				v.goInfo.goColName, v.goInfo.voType,
-				v.goInfo.goColName, v.goInfo.pgValueField, toString)
-			ff("\t} else {\n")
-			ff("\t\tt.VO.%s = %s(%s)\n", v.goInfo.goColName, v.goInfo.voType,
-				v.goInfo.nullValue)
-			ff("\t}\n\n")
-		}
-		ff("\treturn &t.VO\n")
-		ff("}\n\n")
-	}
-	//-------------------------------------------------------------------
-
-	//==========    Generate ConvertVO2Record   ==================
-	{
-		ff(`// ConvertVO2Record - Convert GO types to pgtype types
-func (t *%sTable) ConvertVO2Record() *%sRec {
-`, tableName1, tableName1)
-		for _, v := range cols {
-			errOption := ""
-			if v.goInfo.pgValueField == "Time" {
-				errOption = ", _ "
-			}
-			ff("\tt.Record.%s.Status = pgtype.Present\n", v.goInfo.goColName)
-			ff("\tt.Record.%s.%s%s = %st.VO.%s)\n\n",
-				v.goInfo.goColName, v.goInfo.pgValueField, errOption,
-				v.goInfo.pgTypeCast, v.goInfo.goColName)
-		}
-		ff("\treturn &t.Record\n")
-		ff("}\n\n")
-	}
-	//------------------------------------------------------------------------
-
-	//======   Generate getters and setters  ======================
-	{
-		for _, v := range cols {
-			// Generate the getter
-			toString := ""
-			errOption := ""
-			if v.goInfo.pgValueField == "Time" {
-				toString = ".String()"
-				errOption = ", _ "
-			}
-			ff("func (t *%sTable) Get%s () %s {\n", tableName1, v.goInfo.goColName, v.goInfo.voType)
-			ff("\tif t.Record.%s.Status == pgtype.Present {\n", v.goInfo.goColName)
-			ff("\t\tt.VO.%s = %s(t.Record.%s.%s%s)\n", v.goInfo.goColName, v.goInfo.voType,
-				v.goInfo.goColName, v.goInfo.pgValueField, toString)
-			ff("\t} else {\n")
-			ff("\t\tt.VO.%s = %s(%s)\n", v.goInfo.goColName,
-				v.goInfo.voType, v.goInfo.nullValue)
-			ff("\t}\n\n")
-			ff("\treturn t.VO.%s\n", v.goInfo.goColName)
-			ff("}\n\n")
-
-			// Now generate the setter
-			ff("func (t *%sTable) Set%s (value %s) {\n", tableName1,
-				v.goInfo.goColName, v.goInfo.voType)
-			ff("\tt.VO.%s = value\n", v.goInfo.goColName)
-			ff("\tt.Record.%s.Status = pgtype.Present\n", v.goInfo.goColName)
-			ff("\tt.Record.%s.%s%s = %svalue)\n", v.goInfo.goColName,
-				v.goInfo.pgValueField, errOption, v.goInfo.pgTypeCast)
-			ff("}\n\n")
-		}
-	}
-	//---------------------------------------------------------
-
+// generateProgram - generates the table object from the "table" template
+func generateProgram(tmpl *template.Template, pkg string, tableMap *TableMap) error {
+	defer _global_writer.Flush()
+	return executeTemplate(_global_writer, tmpl, "table", tableData(pkg, tableMap))
 }
 
 func generateSelectStatement(tableName string,
@@ -469,7 +156,7 @@ func generateSelectStatement(tableName string,
 			selectStatement += ", "
 		}
 		c := colDesc[subs]
-		selectStatement += c.ColumnName
+		selectStatement += quoteIdent(c.ColumnName)
 	}
 	selectStatement += " FROM "
 	selectStatement += tableName
@@ -482,7 +169,7 @@ func generateSelectStatement(tableName string,
 			if pos > 1 {
 				whereCond += " AND "
 			}
-			temp := fmt.Sprintf(" %s = $%d ", col.ColumnName, pos)
+			temp := fmt.Sprintf(" %s = $%d ", quoteIdent(col.ColumnName), pos)
 			whereCond += temp
 			pos++
 		}
@@ -499,7 +186,7 @@ func generateInsertStatement(tableName string, tableMap *TableMap) string {
 			statement += ", "
 		}
 		col := colDesc[subs]
-		statement += col.ColumnName
+		statement += quoteIdent(col.ColumnName)
 	}
 	statement += ") VALUES ("
 	for i := 1; i <= len(colSumm.insertCols); i++ {
@@ -517,7 +204,7 @@ func generateInsertStatement(tableName string, tableMap *TableMap) string {
 			if i > 0 {
 				statement += ", "
 			}
-			temp := fmt.Sprintf(" %s ", col.ColumnName)
+			temp := fmt.Sprintf(" %s ", quoteIdent(col.ColumnName))
 			statement += temp
 		}
 	}
@@ -535,10 +222,10 @@ func generateUpdateStatement(tableName string, tableMap *TableMap) string {
 			statement += ", "
 		}
 		col := colDesc[subs]
-		temp := fmt.Sprintf("%s = $%d", col.ColumnName, i+1-versionEncountered)
+		temp := fmt.Sprintf("%s = $%d", quoteIdent(col.ColumnName), i+1-versionEncountered)
 		if col.ColumnName == "version" {
 			versionEncountered = 1
-			temp = fmt.Sprintf("%s = %s + 1", col.ColumnName, col.ColumnName)
+			temp = fmt.Sprintf("%s = %s + 1", quoteIdent(col.ColumnName), quoteIdent(col.ColumnName))
 		}
 		statement += temp
 	}
@@ -548,9 +235,162 @@ func generateUpdateStatement(tableName string, tableMap *TableMap) string {
 			statement += " AND "
 		}
 		col := colDesc[subs]
-		temp := fmt.Sprintf("%s = $%d", col.ColumnName, i+len(colSumm.updateCols)+1)
+		temp := fmt.Sprintf("%s = $%d", quoteIdent(col.ColumnName), i+len(colSumm.updateCols)-versionEncountered+1)
 		statement += temp
 	}
 
 	return statement
 }
+
+// Upsert - an upsert method, inserting the row or updating the row holding
+// the same values of the conflict columns
+type Upsert struct {
+	Method       string
+	Index        string
+	insertCols   []int
+	conflictCols []int
+}
+
+// tableUpserts - works out the upsert methods of the table: Upsert on the
+// primary key, which binds the key columns even if they have a default, and
+// one on each unique key that has a finder. Both bind the columns of Insert
+// and of Update, so that every column of Update can be set
+func tableUpserts(tableMap *TableMap) []Upsert {
+	colSumm := tableMap.colSummary
+	bound := func(keyCols []int) []int {
+		cols := []int{}
+		for i := range tableMap.colDesc {
+			if containsInt(colSumm.insertCols, i) || containsInt(colSumm.updateCols, i) ||
+				containsInt(keyCols, i) {
+				cols = append(cols, i)
+			}
+		}
+		return cols
+	}
+	upserts := []Upsert{}
+	if len(colSumm.primaryCols) > 0 {
+		upserts = append(upserts, Upsert{
+			Method:       "Upsert",
+			insertCols:   bound(colSumm.primaryCols),
+			conflictCols: colSumm.primaryCols,
+		})
+	}
+	for _, f := range tableFinders(tableMap) {
+		if !f.Index.IsUnique {
+			continue
+		}
+		upserts = append(upserts, Upsert{
+			Method:       "Upsert" + strings.TrimPrefix(f.Method, "Select"),
+			Index:        f.Index.Name,
+			insertCols:   bound(nil),
+			conflictCols: f.cols,
+		})
+	}
+	return upserts
+}
+
+// generateUpsertStatement - the INSERT of insertCols that updates the row
+// conflicting on conflictCols instead. The columns of Update are set from
+// the new row and the version is incremented. With nothing to set, the
+// conflict columns are set to themselves so that RETURNING still returns
+// the row
+func generateUpsertStatement(tableName string, tableMap *TableMap, insertCols []int, conflictCols []int) string {
+	colDesc := tableMap.colDesc
+	colSumm := tableMap.colSummary
+	names := []string{}
+	params := []string{}
+	overriding := ""
+	for i, subs := range insertCols {
+		names = append(names, quoteIdent(colDesc[subs].ColumnName))
+		params = append(params, fmt.Sprintf("$%d", i+1))
+		if colDesc[subs].IsIdentity {
+			overriding = " OVERRIDING SYSTEM VALUE"
+		}
+	}
+	conflict := []string{}
+	for _, subs := range conflictCols {
+		conflict = append(conflict, quoteIdent(colDesc[subs].ColumnName))
+	}
+	set := []string{}
+	for _, subs := range colSumm.updateCols {
+		col := colDesc[subs]
+		if col.ColumnName == "version" {
+			set = append(set, fmt.Sprintf("%s = %s.%s + 1", quoteIdent(col.ColumnName),
+				quoteIdent(tableMap.TableName), quoteIdent(col.ColumnName)))
+		} else {
+			name := quoteIdent(col.ColumnName)
+			set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", name, name))
+		}
+	}
+	if len(set) == 0 {
+		for _, name := range conflict {
+			set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", name, name))
+		}
+	}
+	statement := fmt.Sprintf("INSERT INTO %s (%s)%s VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s",
+		tableName, strings.Join(names, ", "), overriding, strings.Join(params, ", "),
+		strings.Join(conflict, ", "), strings.Join(set, ", "))
+	if len(colSumm.returningCols) > 0 {
+		returning := []string{}
+		for _, subs := range colSumm.returningCols {
+			returning = append(returning, quoteIdent(colDesc[subs].ColumnName))
+		}
+		statement += " RETURNING " + strings.Join(returning, ", ")
+	}
+	return statement
+}
+
+// generateDeleteStatement - the DELETE of the row with the given primary
+// key, and the condition on the version column added by DeleteVersioned
+func generateDeleteStatement(tableName string, tableMap *TableMap) (string, string) {
+	primaryCols := tableMap.colSummary.primaryCols
+	statement := fmt.Sprintf("DELETE FROM %s WHERE %s", tableName, whereCond(tableMap, primaryCols))
+	versionCond := fmt.Sprintf(" AND %s = $%d", quoteIdent("version"), len(primaryCols)+1)
+	return statement, versionCond
+}
+
+// Finder - a select method generated for a unique key or a btree index
+type Finder struct {
+	Method string
+	Index  IndexDesc
+	cols   []int
+}
+
+// tableFinders - works out the finder methods of the table. Partial and
+// expression indexes are skipped, as is the primary key which already has
+// Select. Where a unique and a plain index cover the same columns, the
+// unique one wins
+func tableFinders(tableMap *TableMap) []Finder {
+	finders := []Finder{}
+	byMethod := map[string]int{}
+	for _, idx := range tableMap.Indexes {
+		if idx.IsPrimary || idx.IsPartial || idx.Method != "btree" || len(idx.Columns) == 0 {
+			continue
+		}
+		f := Finder{Index: idx, Method: "SelectBy"}
+		for i, colName := range idx.Columns {
+			subs := tableMap.colIndex(colName)
+			if subs < 0 {
+				f.cols = nil
+				break
+			}
+			if i > 0 {
+				f.Method += "And"
+			}
+			f.Method += tableMap.colDesc[subs].goInfo.goColName
+			f.cols = append(f.cols, subs)
+		}
+		if f.cols == nil {
+			continue
+		}
+		if i, ok := byMethod[f.Method]; ok {
+			if idx.IsUnique && !finders[i].Index.IsUnique {
+				finders[i] = f
+			}
+			continue
+		}
+		byMethod[f.Method] = len(finders)
+		finders = append(finders, f)
+	}
+	return finders
+}
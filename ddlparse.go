@@ -0,0 +1,1691 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//=========   Lexer   ===========
+
+type ddlTokenKind int
+
+const (
+	tokIdent ddlTokenKind = iota
+	tokString
+	tokNumber
+	tokPunct
+)
+
+// ddlToken - unquoted identifiers are folded to lower case, as postgres
+// does. pos and end point into the source so that expressions can be kept
+// verbatim
+type ddlToken struct {
+	kind   ddlTokenKind
+	text   string
+	quoted bool
+	pos    int
+	end    int
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
+
+// lexQuoted - reads a quoted string or identifier starting at src[start].
+// Doubled quotes stand for the quote itself
+func lexQuoted(src string, start int, backslash bool) (string, int, error) {
+	quote := src[start]
+	var sb strings.Builder
+	i := start + 1
+	for i < len(src) {
+		c := src[i]
+		if backslash && c == '\\' && i+1 < len(src) {
+			sb.WriteByte(src[i+1])
+			i += 2
+			continue
+		}
+		if c == quote {
+			if i+1 < len(src) && src[i+1] == quote {
+				sb.WriteByte(quote)
+				i += 2
+				continue
+			}
+			return sb.String(), i + 1, nil
+		}
+		sb.WriteByte(c)
+		i++
+	}
+	return "", 0, errors.New("unterminated quoted string")
+}
+
+// dollarTag - returns the $tag$ starting at src[start], if any
+func dollarTag(src string, start int) string {
+	i := start + 1
+	if i < len(src) && isIdentStart(src[i]) {
+		for i < len(src) && isIdentChar(src[i]) && src[i] != '$' {
+			i++
+		}
+	}
+	if i < len(src) && src[i] == '$' {
+		return src[start : i+1]
+	}
+	return ""
+}
+
+func lexDDL(src string) ([]ddlToken, error) {
+	toks := []ddlToken{}
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			depth := 0
+			for i < len(src) {
+				if strings.HasPrefix(src[i:], "/*") {
+					depth++
+					i += 2
+				} else if strings.HasPrefix(src[i:], "*/") {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			if depth > 0 {
+				return nil, errors.New("unterminated comment")
+			}
+		case c == '\'':
+			s, end, err := lexQuoted(src, i, false)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, ddlToken{kind: tokString, text: s, pos: i, end: end})
+			i = end
+		case strings.IndexByte("eEbBxXnN", c) >= 0 && i+1 < len(src) && src[i+1] == '\'':
+			s, end, err := lexQuoted(src, i+1, c == 'e' || c == 'E')
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, ddlToken{kind: tokString, text: s, pos: i, end: end})
+			i = end
+		case c == '"':
+			s, end, err := lexQuoted(src, i, false)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, ddlToken{kind: tokIdent, text: s, quoted: true, pos: i, end: end})
+			i = end
+		case c == '$' && dollarTag(src, i) != "":
+			tag := dollarTag(src, i)
+			closing := strings.Index(src[i+len(tag):], tag)
+			if closing < 0 {
+				return nil, errors.New("unterminated dollar quoted string")
+			}
+			end := i + len(tag) + closing + len(tag)
+			toks = append(toks, ddlToken{kind: tokString, text: src[i+len(tag) : end-len(tag)], pos: i, end: end})
+			i = end
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && isIdentChar(src[i]) {
+				i++
+			}
+			toks = append(toks, ddlToken{kind: tokIdent, text: strings.ToLower(src[start:i]), pos: start, end: i})
+		case (c >= '0' && c <= '9') || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			start := i
+			for i < len(src) && (isIdentChar(src[i]) || src[i] == '.') {
+				i++
+			}
+			toks = append(toks, ddlToken{kind: tokNumber, text: src[start:i], pos: start, end: i})
+		case strings.HasPrefix(src[i:], "::"):
+			toks = append(toks, ddlToken{kind: tokPunct, text: "::", pos: i, end: i + 2})
+			i += 2
+		default:
+			toks = append(toks, ddlToken{kind: tokPunct, text: string(c), pos: i, end: i + 1})
+			i++
+		}
+	}
+	return toks, nil
+}
+
+//=========   Parser helpers   ===========
+
+type ddlParser struct {
+	src  string
+	toks []ddlToken
+	i    int
+}
+
+func (p *ddlParser) peekAt(n int) *ddlToken {
+	if p.i+n < len(p.toks) {
+		return &p.toks[p.i+n]
+	}
+	return nil
+}
+
+func (p *ddlParser) atEnd() bool {
+	return p.i >= len(p.toks)
+}
+
+func (p *ddlParser) isKeywordAt(n int, kw string) bool {
+	t := p.peekAt(n)
+	return t != nil && t.kind == tokIdent && !t.quoted && t.text == kw
+}
+
+func (p *ddlParser) isKeyword(kw string) bool {
+	return p.isKeywordAt(0, kw)
+}
+
+// acceptKeywords - consumes the given keyword sequence if all of it matches
+func (p *ddlParser) acceptKeywords(kws ...string) bool {
+	for n, kw := range kws {
+		if !p.isKeywordAt(n, kw) {
+			return false
+		}
+	}
+	p.i += len(kws)
+	return true
+}
+
+func (p *ddlParser) expectKeywords(kws ...string) error {
+	if !p.acceptKeywords(kws...) {
+		return p.errorf("expected %s", strings.ToUpper(strings.Join(kws, " ")))
+	}
+	return nil
+}
+
+func (p *ddlParser) isPunct(s string) bool {
+	t := p.peekAt(0)
+	return t != nil && t.kind == tokPunct && t.text == s
+}
+
+func (p *ddlParser) acceptPunct(s string) bool {
+	if p.isPunct(s) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *ddlParser) expectPunct(s string) error {
+	if !p.acceptPunct(s) {
+		return p.errorf("expected %s", s)
+	}
+	return nil
+}
+
+func (p *ddlParser) errorf(format string, args ...interface{}) error {
+	pos := len(p.src)
+	near := "end of statement"
+	if t := p.peekAt(0); t != nil {
+		pos = t.pos
+		near = p.src[t.pos:t.end]
+	}
+	line := strings.Count(p.src[:pos], "\n") + 1
+	return fmt.Errorf("line %d near %q: %s", line, near, fmt.Sprintf(format, args...))
+}
+
+func (p *ddlParser) ident() (string, error) {
+	t := p.peekAt(0)
+	if t == nil || t.kind != tokIdent {
+		return "", p.errorf("expected identifier")
+	}
+	p.i++
+	return t.text, nil
+}
+
+// qualifiedName - reads [schema.]name, defaulting the schema to public
+func (p *ddlParser) qualifiedName() (string, string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", "", err
+	}
+	if p.acceptPunct(".") {
+		table, err := p.ident()
+		return name, table, err
+	}
+	return "public", name, nil
+}
+
+// identList - reads a parenthesized, comma separated list of identifiers
+func (p *ddlParser) identList() ([]string, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	return names, p.expectPunct(")")
+}
+
+// skipExpr - consumes tokens up to a comma or closing parenthesis at the
+// current nesting level, or up to one of the stop keywords. Returns the
+// verbatim source text and the identifiers used in it
+func (p *ddlParser) skipExpr(stopKeywords ...string) (string, []string) {
+	depth := 0
+	start := p.i
+	idents := []string{}
+loop:
+	for !p.atEnd() {
+		t := p.peekAt(0)
+		if t.kind == tokPunct {
+			switch t.text {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				if depth == 0 {
+					break loop
+				}
+				depth--
+			case ",":
+				if depth == 0 {
+					break loop
+				}
+			}
+		} else if t.kind == tokIdent {
+			if depth == 0 && !t.quoted {
+				for _, kw := range stopKeywords {
+					if t.text == kw {
+						break loop
+					}
+				}
+			}
+			idents = append(idents, t.text)
+		}
+		p.i++
+	}
+	if p.i == start {
+		return "", idents
+	}
+	return p.src[p.toks[start].pos:p.toks[p.i-1].end], idents
+}
+
+// parenExpr - reads a parenthesized expression, returning the text inside
+func (p *ddlParser) parenExpr() (string, []string, error) {
+	if err := p.expectPunct("("); err != nil {
+		return "", nil, err
+	}
+	expr, idents := p.skipExpr()
+	return expr, idents, p.expectPunct(")")
+}
+
+//=========   Type names   ===========
+
+// ddlType - a type name as written in the DDL, e.g. numeric(10,2) or text[]
+type ddlType struct {
+	schema string
+	name   string
+	quoted bool
+	args   []string
+	dims   int
+}
+
+var columnConstraintKeywords = []string{"constraint", "not", "null", "default", "primary",
+	"unique", "references", "check", "collate", "generated", "using"}
+
+func (p *ddlParser) typeName() (ddlType, error) {
+	t := ddlType{}
+	words := []string{}
+	for !p.atEnd() {
+		tok := p.peekAt(0)
+		if tok.kind == tokIdent {
+			isStop := false
+			for _, kw := range columnConstraintKeywords {
+				if !tok.quoted && tok.text == kw {
+					isStop = true
+				}
+			}
+			if isStop && len(words) > 0 {
+				break
+			}
+			if !tok.quoted && tok.text == "array" {
+				p.i++
+				t.dims++
+				if p.acceptPunct("[") {
+					p.skipExpr()
+					p.acceptPunct("]")
+				}
+				continue
+			}
+			p.i++
+			if p.acceptPunct(".") {
+				t.schema = tok.text
+				continue
+			}
+			words = append(words, tok.text)
+			t.quoted = tok.quoted
+		} else if tok.kind == tokPunct && tok.text == "(" {
+			p.i++
+			for {
+				arg, _ := p.skipExpr()
+				t.args = append(t.args, arg)
+				if !p.acceptPunct(",") {
+					break
+				}
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return t, err
+			}
+		} else if tok.kind == tokPunct && tok.text == "[" {
+			p.i++
+			p.skipExpr()
+			if err := p.expectPunct("]"); err != nil {
+				return t, err
+			}
+			t.dims++
+		} else {
+			break
+		}
+	}
+	if len(words) == 0 {
+		return t, p.errorf("expected type name")
+	}
+	// timestamp(3) with time zone carries the precision in the middle,
+	// which has been taken out into args already
+	t.name = strings.Join(words, " ")
+	if strings.HasPrefix(t.name, "interval ") {
+		t.name = "interval"
+	}
+	return t, nil
+}
+
+var serialTypes = map[string]bool{
+	"serial": true, "serial4": true, "bigserial": true, "serial8": true,
+	"smallserial": true, "serial2": true,
+}
+
+// typeMod - the atttypmod postgres would store for the type arguments
+func typeMod(bt *pgBuiltinType, args []string) int32 {
+	nums := []int{}
+	for _, a := range args {
+		n, err := strconv.Atoi(strings.TrimSpace(a))
+		if err != nil {
+			return -1
+		}
+		nums = append(nums, n)
+	}
+	switch bt.typName {
+	case "varchar", "bpchar":
+		if len(nums) == 0 {
+			if bt.typName == "bpchar" {
+				return 5
+			}
+			return -1
+		}
+		return int32(nums[0] + 4)
+	case "numeric":
+		if len(nums) == 0 {
+			return -1
+		}
+		scale := 0
+		if len(nums) > 1 {
+			scale = nums[1]
+		}
+		return int32((nums[0]<<16)|scale) + 4
+	case "time", "timetz", "timestamp", "timestamptz", "interval", "bit", "varbit":
+		if len(nums) == 0 {
+			return -1
+		}
+		return int32(nums[0])
+	}
+	return -1
+}
+
+// setColumnType - fills the type fields of the column the way pg_catalog
+// describes them
+func setColumnType(mp *TableMap, col *ColDesc, t ddlType) {
+	if serialTypes[t.name] {
+		col.ColumnDefault = fmt.Sprintf("nextval('%s_%s_seq'::regclass)", mp.TableName, col.ColumnName)
+		col.IsNullable = false
+	}
+	name := t.name
+	if name == "float" && len(t.args) == 1 {
+		if n, err := strconv.Atoi(t.args[0]); err == nil && n <= 24 {
+			name = "real"
+		}
+	}
+	col.TypeMod = -1
+	col.Dimensions = 0
+	col.ElemTypeOID = 0
+	bt := lookupBuiltinType(name)
+	if t.quoted {
+		// "char" is the single byte type, not an alias of character
+		bt = lookupBuiltinTypeName(name)
+	}
+	if t.schema != "" && t.schema != "pg_catalog" {
+		bt = nil
+	}
+	if bt != nil {
+		col.DataType = bt.dataType
+		col.TypeName = bt.typName
+		col.TypeOID = bt.oid
+		col.TypeSchema = "pg_catalog"
+		col.TypeKind = "b"
+		col.TypeMod = typeMod(bt, t.args)
+	} else {
+		col.DataType = "USER-DEFINED"
+		col.TypeName = name
+		col.TypeOID = 0
+		col.TypeSchema = t.schema
+		if col.TypeSchema == "" {
+			col.TypeSchema = "public"
+		}
+		col.TypeKind = ""
+	}
+	if t.dims > 0 {
+		col.ElemTypeOID = col.TypeOID
+		col.TypeOID = 0
+		if bt != nil {
+			col.TypeOID = bt.arrayOID
+		}
+		col.TypeName = "_" + col.TypeName
+		col.DataType = "ARRAY"
+		col.TypeKind = "b"
+		col.Dimensions = t.dims
+	}
+}
+
+//=========   Statements   ===========
+
+// ddlLoader - replays DDL statements into table maps. Constraint definitions
+// and key membership are only worked out in finalize, as later ALTER TABLE
+// statements can still change them
+type ddlLoader struct {
+	tables     map[string]*TableMap
+	enums      map[string]*EnumDesc
+	composites map[string]*CompositeDesc
+	domains    map[string]*DomainDesc
+}
+
+// LoadDDLMeta - builds the table metadata by replaying the CREATE TABLE,
+// ALTER TABLE, CREATE INDEX, DROP TABLE, type and domain statements of all .sql
+// files in dir, in file name order. Down migrations (*.down.sql) are skipped
+func LoadDDLMeta(dir string, schemas []string) *DBMeta {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		fmt.Println("***ERROR*** : Reading migrations directory. Error = ", err)
+		return nil
+	}
+	l := ddlLoader{tables: map[string]*TableMap{}, enums: map[string]*EnumDesc{},
+		composites: map[string]*CompositeDesc{}, domains: map[string]*DomainDesc{}}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, ".down.sql") {
+			continue
+		}
+		src, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			fmt.Println("***ERROR*** : Reading migration", name, "Error = ", err)
+			return nil
+		}
+		if err := l.parseFile(string(src)); err != nil {
+			fmt.Println("***ERROR*** : Parsing migration", name, err)
+			return nil
+		}
+	}
+	return l.finalize(schemas)
+}
+
+func (l *ddlLoader) parseFile(src string) error {
+	toks, err := lexDDL(src)
+	if err != nil {
+		return err
+	}
+	start := 0
+	for i := 0; i <= len(toks); i++ {
+		if i < len(toks) && !(toks[i].kind == tokPunct && toks[i].text == ";") {
+			continue
+		}
+		if i > start {
+			p := ddlParser{src: src, toks: toks[start:i]}
+			if err := l.statement(&p); err != nil {
+				return err
+			}
+		}
+		start = i + 1
+	}
+	return nil
+}
+
+func (l *ddlLoader) statement(p *ddlParser) error {
+	switch {
+	case p.acceptKeywords("create"):
+		p.acceptKeywords("or", "replace")
+		for p.acceptKeywords("global") || p.acceptKeywords("local") || p.acceptKeywords("unlogged") {
+		}
+		if p.acceptKeywords("temporary") || p.acceptKeywords("temp") {
+			return nil
+		}
+		if p.acceptKeywords("table") {
+			return l.createTable(p)
+		}
+		if p.acceptKeywords("view") || p.acceptKeywords("recursive", "view") ||
+			p.acceptKeywords("materialized", "view") {
+			p.acceptKeywords("if", "not", "exists")
+			schema, name, err := p.qualifiedName()
+			if err != nil {
+				return err
+			}
+			fmt.Println("***WARNING***", "Skipping view", schema+"."+name,
+				"- the columns of views are only known to a database")
+			return nil
+		}
+		unique := p.acceptKeywords("unique")
+		if p.acceptKeywords("index") {
+			return l.createIndex(p, unique)
+		}
+		if p.acceptKeywords("type") {
+			return l.createType(p)
+		}
+		if p.acceptKeywords("domain") {
+			return l.createDomain(p)
+		}
+	case p.acceptKeywords("alter", "table"):
+		return l.alterTable(p)
+	case p.acceptKeywords("drop", "table"):
+		return l.dropTable(p)
+	case p.acceptKeywords("alter", "type"):
+		return l.alterType(p)
+	case p.acceptKeywords("alter", "domain"):
+		return l.alterDomain(p)
+	case p.acceptKeywords("drop", "type"), p.acceptKeywords("drop", "domain"):
+		p.acceptKeywords("if", "exists")
+		for {
+			schema, name, err := p.qualifiedName()
+			if err != nil {
+				return err
+			}
+			delete(l.enums, schema+"."+name)
+			delete(l.composites, schema+"."+name)
+			delete(l.domains, schema+"."+name)
+			if !p.acceptPunct(",") {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// stringLiteral - reads a string constant
+func (p *ddlParser) stringLiteral() (string, error) {
+	t := p.peekAt(0)
+	if t == nil || t.kind != tokString {
+		return "", p.errorf("expected string constant")
+	}
+	p.i++
+	return t.text, nil
+}
+
+// createType - enums and composite types are of interest, range and base
+// types are ignored
+func (l *ddlLoader) createType(p *ddlParser) error {
+	schema, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if p.acceptKeywords("as") && p.isPunct("(") {
+		return l.createComposite(p, schema, name)
+	}
+	if !p.acceptKeywords("enum") {
+		return nil
+	}
+	e := EnumDesc{Schema: schema, Name: name, Labels: []string{}}
+	if err := p.expectPunct("("); err != nil {
+		return err
+	}
+	for !p.isPunct(")") {
+		label, err := p.stringLiteral()
+		if err != nil {
+			return err
+		}
+		e.Labels = append(e.Labels, label)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	l.enums[e.QualifiedName()] = &e
+	return p.expectPunct(")")
+}
+
+// alterType - ADD VALUE and RENAME VALUE of enums, attribute changes of
+// composite types
+func (l *ddlLoader) alterType(p *ddlParser) error {
+	schema, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if c, ok := l.composites[schema+"."+name]; ok {
+		for {
+			if err := l.alterAttribute(p, c); err != nil {
+				return err
+			}
+			if !p.acceptPunct(",") {
+				return nil
+			}
+		}
+	}
+	e, ok := l.enums[schema+"."+name]
+	if !ok {
+		return nil
+	}
+	switch {
+	case p.acceptKeywords("add", "value"):
+		p.acceptKeywords("if", "not", "exists")
+		label, err := p.stringLiteral()
+		if err != nil {
+			return err
+		}
+		if containsString(e.Labels, label) {
+			return nil
+		}
+		pos := len(e.Labels)
+		before := p.acceptKeywords("before")
+		if before || p.acceptKeywords("after") {
+			neighbour, err := p.stringLiteral()
+			if err != nil {
+				return err
+			}
+			for i, v := range e.Labels {
+				if v == neighbour {
+					pos = i
+					if !before {
+						pos = i + 1
+					}
+				}
+			}
+		}
+		e.Labels = append(e.Labels[:pos], append([]string{label}, e.Labels[pos:]...)...)
+	case p.acceptKeywords("rename", "value"):
+		oldLabel, err := p.stringLiteral()
+		if err != nil {
+			return err
+		}
+		if err = p.expectKeywords("to"); err != nil {
+			return err
+		}
+		newLabel, err := p.stringLiteral()
+		if err != nil {
+			return err
+		}
+		renameInList(e.Labels, oldLabel, newLabel)
+	}
+	return nil
+}
+
+// createComposite - reads the attribute list of CREATE TYPE name AS (...)
+func (l *ddlLoader) createComposite(p *ddlParser, schema string, name string) error {
+	c := CompositeDesc{Schema: schema, Name: name, Attributes: []ColDesc{}}
+	p.i++
+	for !p.isPunct(")") {
+		if err := c.addAttribute(p); err != nil {
+			return err
+		}
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	l.composites[c.QualifiedName()] = &c
+	return p.expectPunct(")")
+}
+
+// addAttribute - reads an attribute name and type, with an optional COLLATE
+func (c *CompositeDesc) addAttribute(p *ddlParser) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	attr := ColDesc{TableSchema: c.Schema, TableName: c.Name, ColumnName: name,
+		IsNullable: true, OrdinalPosition: len(c.Attributes) + 1}
+	if n := len(c.Attributes); n > 0 {
+		attr.OrdinalPosition = c.Attributes[n-1].OrdinalPosition + 1
+	}
+	t, err := p.typeName()
+	if err != nil {
+		return err
+	}
+	setColumnType(CreateNewTablemap(c.Schema, c.Name), &attr, t)
+	if p.acceptKeywords("collate") {
+		if _, _, err := p.qualifiedName(); err != nil {
+			return err
+		}
+	}
+	c.Attributes = append(c.Attributes, attr)
+	return nil
+}
+
+// attrIndex - position of the attribute in Attributes, -1 if not found
+func (c *CompositeDesc) attrIndex(name string) int {
+	for i := range c.Attributes {
+		if c.Attributes[i].ColumnName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// alterAttribute - ADD, DROP, ALTER and RENAME ATTRIBUTE of composite types
+func (l *ddlLoader) alterAttribute(p *ddlParser, c *CompositeDesc) error {
+	switch {
+	case p.acceptKeywords("add", "attribute"):
+		if err := c.addAttribute(p); err != nil {
+			return err
+		}
+	case p.acceptKeywords("drop", "attribute"):
+		p.acceptKeywords("if", "exists")
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if i := c.attrIndex(name); i >= 0 {
+			c.Attributes = append(c.Attributes[:i], c.Attributes[i+1:]...)
+		}
+	case p.acceptKeywords("alter", "attribute"):
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		i := c.attrIndex(name)
+		if i < 0 {
+			return p.errorf("attribute %s not found in %s", name, c.QualifiedName())
+		}
+		p.acceptKeywords("set", "data")
+		if err = p.expectKeywords("type"); err != nil {
+			return err
+		}
+		t, err := p.typeName()
+		if err != nil {
+			return err
+		}
+		setColumnType(CreateNewTablemap(c.Schema, c.Name), &c.Attributes[i], t)
+	case p.acceptKeywords("rename", "attribute"):
+		oldName, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if err = p.expectKeywords("to"); err != nil {
+			return err
+		}
+		newName, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if i := c.attrIndex(oldName); i >= 0 {
+			c.Attributes[i].ColumnName = newName
+		}
+	}
+	p.skipExpr()
+	return nil
+}
+
+// createDomain - reads CREATE DOMAIN name [AS] type followed by DEFAULT,
+// NOT NULL and CHECK constraints
+func (l *ddlLoader) createDomain(p *ddlParser) error {
+	schema, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	p.acceptKeywords("as")
+	t, err := p.typeName()
+	if err != nil {
+		return err
+	}
+	d := DomainDesc{Schema: schema, Name: name, Checks: []ConstraintDesc{}}
+	d.BaseType = ColDesc{TableSchema: schema, TableName: name, IsNullable: true}
+	setColumnType(CreateNewTablemap(schema, name), &d.BaseType, t)
+	for {
+		conName := ""
+		if p.acceptKeywords("constraint") {
+			if conName, err = p.ident(); err != nil {
+				return err
+			}
+		}
+		switch {
+		case p.acceptKeywords("collate"):
+			if _, _, err := p.qualifiedName(); err != nil {
+				return err
+			}
+		case p.acceptKeywords("default"):
+			d.Default, _ = p.skipExpr(columnConstraintKeywords...)
+		case p.acceptKeywords("not", "null"):
+			d.NotNull = true
+		case p.acceptKeywords("null"):
+			d.NotNull = false
+		case p.acceptKeywords("check"):
+			if err := d.addCheck(p, conName); err != nil {
+				return err
+			}
+		default:
+			d.BaseType.IsNullable = !d.NotNull
+			l.domains[d.QualifiedName()] = &d
+			if conName != "" {
+				return p.errorf("expected constraint")
+			}
+			return nil
+		}
+	}
+}
+
+// addCheck - reads the expression of a CHECK constraint of the domain.
+// Unnamed constraints are named the way postgres does
+func (d *DomainDesc) addCheck(p *ddlParser, conName string) error {
+	expr, _, err := p.parenExpr()
+	if err != nil {
+		return err
+	}
+	p.acceptKeywords("not", "valid")
+	if conName == "" {
+		conName = d.Name + "_check"
+		for n := 1; d.checkIndex(conName) >= 0; n++ {
+			conName = fmt.Sprintf("%s_check%d", d.Name, n)
+		}
+	}
+	d.Checks = append(d.Checks, ConstraintDesc{Name: conName, Type: "CHECK",
+		Definition: "CHECK (" + expr + ")"})
+	return nil
+}
+
+// checkIndex - position of the named CHECK constraint, -1 if not found
+func (d *DomainDesc) checkIndex(name string) int {
+	for i := range d.Checks {
+		if d.Checks[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// alterDomain - constraint, default and NOT NULL changes of domains
+func (l *ddlLoader) alterDomain(p *ddlParser) error {
+	schema, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	d, ok := l.domains[schema+"."+name]
+	if !ok {
+		return nil
+	}
+	switch {
+	case p.acceptKeywords("add"):
+		conName := ""
+		if p.acceptKeywords("constraint") {
+			if conName, err = p.ident(); err != nil {
+				return err
+			}
+		}
+		if p.acceptKeywords("not", "null") {
+			d.NotNull = true
+		} else if p.acceptKeywords("check") {
+			if err := d.addCheck(p, conName); err != nil {
+				return err
+			}
+		}
+	case p.acceptKeywords("drop", "constraint"):
+		p.acceptKeywords("if", "exists")
+		conName, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if i := d.checkIndex(conName); i >= 0 {
+			d.Checks = append(d.Checks[:i], d.Checks[i+1:]...)
+		}
+	case p.acceptKeywords("rename", "constraint"):
+		oldName, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if err = p.expectKeywords("to"); err != nil {
+			return err
+		}
+		newName, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if i := d.checkIndex(oldName); i >= 0 {
+			d.Checks[i].Name = newName
+		}
+	case p.acceptKeywords("set", "not", "null"):
+		d.NotNull = true
+	case p.acceptKeywords("drop", "not", "null"):
+		d.NotNull = false
+	case p.acceptKeywords("set", "default"):
+		d.Default, _ = p.skipExpr()
+	case p.acceptKeywords("drop", "default"):
+		d.Default = ""
+	}
+	d.BaseType.IsNullable = !d.NotNull
+	return nil
+}
+
+// typeKind - the pg_type.typtype of a user defined type referred to by
+// name, as known to the loader
+func (l *ddlLoader) typeKind(col *ColDesc) string {
+	key := col.TypeSchema + "." + col.TypeName
+	if _, ok := l.enums[key]; ok {
+		return "e"
+	}
+	if _, ok := l.composites[key]; ok {
+		return "c"
+	}
+	if _, ok := l.domains[key]; ok {
+		return "d"
+	}
+	return ""
+}
+
+func (l *ddlLoader) table(schema string, name string) *TableMap {
+	return l.tables[schema+"."+name]
+}
+
+func (l *ddlLoader) createTable(p *ddlParser) error {
+	p.acceptKeywords("if", "not", "exists")
+	schema, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if !p.isPunct("(") {
+		// CREATE TABLE ... AS / PARTITION OF / OF type
+		fmt.Println("***WARNING***", "Skipping table", schema+"."+name, "- columns are not given explicitly")
+		return nil
+	}
+	p.i++
+	mp := CreateNewTablemap(schema, name)
+	l.tables[mp.QualifiedName()] = mp
+	if p.acceptPunct(")") {
+		return nil
+	}
+	for {
+		if err := l.tableElement(p, mp); err != nil {
+			return err
+		}
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	return p.expectPunct(")")
+}
+
+func (p *ddlParser) isTableConstraint() bool {
+	for _, kw := range []string{"constraint", "primary", "unique", "foreign", "check", "exclude"} {
+		if p.isKeyword(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *ddlLoader) tableElement(p *ddlParser, mp *TableMap) error {
+	if p.isTableConstraint() {
+		return l.tableConstraint(p, mp)
+	}
+	if p.acceptKeywords("like") {
+		fmt.Println("***WARNING***", "LIKE in table", mp.QualifiedName(), "is not supported")
+		p.skipExpr()
+		return nil
+	}
+	return l.columnDef(p, mp)
+}
+
+func (l *ddlLoader) columnDef(p *ddlParser, mp *TableMap) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	col := ColDesc{
+		TableSchema:     mp.TableSchema,
+		TableName:       mp.TableName,
+		ColumnName:      name,
+		IsNullable:      true,
+		OrdinalPosition: mp.lastAttnum + 1,
+	}
+	// Dropped columns keep their attnum, so it is never used again
+	mp.lastAttnum = col.OrdinalPosition
+	t, err := p.typeName()
+	if err != nil {
+		return err
+	}
+	setColumnType(mp, &col, t)
+	mp.colDesc = append(mp.colDesc, col)
+	return l.columnConstraints(p, mp, len(mp.colDesc)-1)
+}
+
+func (l *ddlLoader) columnConstraints(p *ddlParser, mp *TableMap, colNum int) error {
+	for {
+		col := &mp.colDesc[colNum]
+		conName := ""
+		if p.acceptKeywords("constraint") {
+			var err error
+			if conName, err = p.ident(); err != nil {
+				return err
+			}
+		}
+		switch {
+		case p.acceptKeywords("not", "deferrable"), p.acceptKeywords("deferrable"),
+			p.acceptKeywords("initially", "deferred"), p.acceptKeywords("initially", "immediate"):
+		case p.acceptKeywords("not", "null"):
+			col.IsNullable = false
+		case p.acceptKeywords("null"):
+			col.IsNullable = true
+		case p.acceptKeywords("default"):
+			col.ColumnDefault, _ = p.skipExpr(columnConstraintKeywords...)
+		case p.acceptKeywords("primary", "key"):
+			l.addConstraint(mp, ConstraintDesc{Name: conName, Type: "PRIMARY KEY", Columns: []string{col.ColumnName}})
+		case p.acceptKeywords("unique"):
+			p.acceptKeywords("nulls", "not", "distinct")
+			p.acceptKeywords("nulls", "distinct")
+			l.addConstraint(mp, ConstraintDesc{Name: conName, Type: "UNIQUE", Columns: []string{col.ColumnName}})
+		case p.acceptKeywords("references"):
+			con := ConstraintDesc{Name: conName, Type: "FOREIGN KEY", Columns: []string{col.ColumnName}}
+			if err := p.references(&con); err != nil {
+				return err
+			}
+			l.addConstraint(mp, con)
+		case p.acceptKeywords("check"):
+			expr, _, err := p.parenExpr()
+			if err != nil {
+				return err
+			}
+			p.acceptKeywords("no", "inherit")
+			l.addConstraint(mp, ConstraintDesc{Name: conName, Type: "CHECK", Columns: []string{col.ColumnName},
+				Definition: "CHECK (" + expr + ")"})
+		case p.acceptKeywords("collate"):
+			if _, _, err := p.qualifiedName(); err != nil {
+				return err
+			}
+		case p.acceptKeywords("generated"):
+			if err := p.generated(col); err != nil {
+				return err
+			}
+		default:
+			if conName != "" {
+				return p.errorf("expected constraint")
+			}
+			return nil
+		}
+	}
+}
+
+// generated - reads the rest of GENERATED ... AS IDENTITY or
+// GENERATED ALWAYS AS (expr) STORED
+func (p *ddlParser) generated(col *ColDesc) error {
+	if !p.acceptKeywords("always") {
+		p.acceptKeywords("by", "default")
+	}
+	if err := p.expectKeywords("as"); err != nil {
+		return err
+	}
+	if p.acceptKeywords("identity") {
+		col.IsIdentity = true
+		col.IsNullable = false
+		if p.isPunct("(") {
+			p.i++
+			p.skipExpr()
+			return p.expectPunct(")")
+		}
+		return nil
+	}
+	expr, _, err := p.parenExpr()
+	if err != nil {
+		return err
+	}
+	p.acceptKeywords("stored")
+	col.IsGenerated = true
+	col.ColumnDefault = expr
+	return nil
+}
+
+// references - reads REFERENCES table [(cols)] [MATCH ..] [ON DELETE ..]
+func (p *ddlParser) references(con *ConstraintDesc) error {
+	var err error
+	if con.RefSchema, con.RefTable, err = p.qualifiedName(); err != nil {
+		return err
+	}
+	if p.isPunct("(") {
+		if con.RefColumns, err = p.identList(); err != nil {
+			return err
+		}
+	}
+	for {
+		switch {
+		case p.acceptKeywords("match"):
+			p.i++
+		case p.acceptKeywords("on"):
+			p.i++
+			if p.acceptKeywords("set") {
+				p.i++
+				if p.isPunct("(") {
+					if _, err := p.identList(); err != nil {
+						return err
+					}
+				}
+			} else if p.acceptKeywords("no", "action") {
+			} else {
+				p.i++
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (l *ddlLoader) tableConstraint(p *ddlParser, mp *TableMap) error {
+	con := ConstraintDesc{}
+	if p.acceptKeywords("constraint") {
+		var err error
+		if con.Name, err = p.ident(); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch {
+	case p.acceptKeywords("primary", "key"):
+		con.Type = "PRIMARY KEY"
+		con.Columns, err = p.identList()
+	case p.acceptKeywords("unique"):
+		p.acceptKeywords("nulls", "not", "distinct")
+		p.acceptKeywords("nulls", "distinct")
+		con.Type = "UNIQUE"
+		con.Columns, err = p.identList()
+	case p.acceptKeywords("foreign", "key"):
+		con.Type = "FOREIGN KEY"
+		if con.Columns, err = p.identList(); err == nil {
+			if err = p.expectKeywords("references"); err == nil {
+				err = p.references(&con)
+			}
+		}
+	case p.acceptKeywords("check"):
+		con.Type = "CHECK"
+		var expr string
+		var idents []string
+		if expr, idents, err = p.parenExpr(); err == nil {
+			con.Definition = "CHECK (" + expr + ")"
+			con.Columns = []string{}
+			for _, col := range mp.colDesc {
+				for _, id := range idents {
+					if id == col.ColumnName {
+						con.Columns = append(con.Columns, id)
+						break
+					}
+				}
+			}
+		}
+	default:
+		// EXCLUDE and anything else is of no interest to the generator
+		p.skipExpr()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// DEFERRABLE, NOT VALID, USING INDEX TABLESPACE ...
+	p.skipExpr()
+	l.addConstraint(mp, con)
+	return nil
+}
+
+// addConstraint - names the constraint the way postgres would if no name
+// was given
+func (l *ddlLoader) addConstraint(mp *TableMap, con ConstraintDesc) {
+	if con.Name == "" {
+		cols := strings.Join(con.Columns, "_")
+		switch con.Type {
+		case "PRIMARY KEY":
+			con.Name = mp.TableName + "_pkey"
+		case "UNIQUE":
+			con.Name = mp.TableName + "_" + cols + "_key"
+		case "FOREIGN KEY":
+			con.Name = mp.TableName + "_" + cols + "_fkey"
+		case "CHECK":
+			if cols == "" {
+				con.Name = mp.TableName + "_check"
+			} else {
+				con.Name = mp.TableName + "_" + cols + "_check"
+			}
+		}
+	}
+	if con.RefColumns == nil {
+		con.RefColumns = []string{}
+	}
+	mp.Constraints = append(mp.Constraints, con)
+}
+
+func (l *ddlLoader) createIndex(p *ddlParser, unique bool) error {
+	p.acceptKeywords("concurrently")
+	p.acceptKeywords("if", "not", "exists")
+	idx := IndexDesc{Method: "btree", IsUnique: unique, Columns: []string{}}
+	if !p.isKeyword("on") {
+		var err error
+		if idx.Name, err = p.ident(); err != nil {
+			return err
+		}
+	}
+	if err := p.expectKeywords("on"); err != nil {
+		return err
+	}
+	p.acceptKeywords("only")
+	schema, table, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if p.acceptKeywords("using") {
+		if idx.Method, err = p.ident(); err != nil {
+			return err
+		}
+	}
+	if err := p.expectPunct("("); err != nil {
+		return err
+	}
+	nameParts := []string{}
+	for {
+		// A plain column is an identifier followed by nothing but options
+		colName := ""
+		if t := p.peekAt(0); t != nil && t.kind == tokIdent {
+			if next := p.peekAt(1); next == nil || !(next.kind == tokPunct && next.text == "(") {
+				colName = t.text
+			}
+		}
+		_, idents := p.skipExpr()
+		idx.Columns = append(idx.Columns, colName)
+		if colName != "" {
+			nameParts = append(nameParts, colName)
+		} else if len(idents) > 0 {
+			nameParts = append(nameParts, idents[0])
+		} else {
+			nameParts = append(nameParts, "expr")
+		}
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return err
+	}
+	for !p.atEnd() {
+		if p.acceptKeywords("where") {
+			idx.IsPartial = true
+			break
+		}
+		p.i++
+	}
+	mp := l.table(schema, table)
+	if mp == nil {
+		return nil
+	}
+	if idx.Name == "" {
+		idx.Name = mp.TableName + "_" + strings.Join(nameParts, "_") + "_idx"
+	}
+	mp.Indexes = append(mp.Indexes, idx)
+	return nil
+}
+
+func (l *ddlLoader) alterTable(p *ddlParser) error {
+	p.acceptKeywords("if", "exists")
+	p.acceptKeywords("only")
+	schema, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	mp := l.table(schema, name)
+	if mp == nil {
+		return nil
+	}
+	for {
+		if err := l.alterAction(p, mp); err != nil {
+			return err
+		}
+		if !p.acceptPunct(",") {
+			return nil
+		}
+	}
+}
+
+func (l *ddlLoader) alterAction(p *ddlParser, mp *TableMap) error {
+	switch {
+	case p.acceptKeywords("add"):
+		if p.isTableConstraint() {
+			return l.tableConstraint(p, mp)
+		}
+		p.acceptKeywords("column")
+		if p.acceptKeywords("if", "not", "exists") {
+			if t := p.peekAt(0); t != nil && mp.colIndex(t.text) >= 0 {
+				p.skipExpr()
+				return nil
+			}
+		}
+		return l.columnDef(p, mp)
+	case p.acceptKeywords("drop"):
+		if p.acceptKeywords("constraint") {
+			p.acceptKeywords("if", "exists")
+			conName, err := p.ident()
+			if err != nil {
+				return err
+			}
+			l.dropConstraint(mp, conName)
+		} else {
+			p.acceptKeywords("column")
+			p.acceptKeywords("if", "exists")
+			colName, err := p.ident()
+			if err != nil {
+				return err
+			}
+			l.dropColumn(mp, colName)
+		}
+		p.skipExpr()
+		return nil
+	case p.acceptKeywords("alter"):
+		p.acceptKeywords("column")
+		colName, err := p.ident()
+		if err != nil {
+			return err
+		}
+		i := mp.colIndex(colName)
+		if i < 0 {
+			return p.errorf("column %s not found in %s", colName, mp.QualifiedName())
+		}
+		col := &mp.colDesc[i]
+		switch {
+		case p.acceptKeywords("set", "default"):
+			col.ColumnDefault, _ = p.skipExpr()
+		case p.acceptKeywords("drop", "default"):
+			col.ColumnDefault = ""
+		case p.acceptKeywords("set", "not", "null"):
+			col.IsNullable = false
+		case p.acceptKeywords("drop", "not", "null"):
+			col.IsNullable = true
+		case p.acceptKeywords("set", "data", "type"), p.acceptKeywords("type"):
+			t, err := p.typeName()
+			if err != nil {
+				return err
+			}
+			setColumnType(mp, col, t)
+		case p.acceptKeywords("add", "generated"):
+			p.i--
+			if err := p.generated(col); err != nil {
+				return err
+			}
+		case p.acceptKeywords("drop", "identity"):
+			col.IsIdentity = false
+		case p.acceptKeywords("drop", "expression"):
+			col.IsGenerated = false
+			col.ColumnDefault = ""
+		}
+		p.skipExpr()
+		return nil
+	case p.acceptKeywords("rename"):
+		if p.acceptKeywords("to") {
+			newName, err := p.ident()
+			if err != nil {
+				return err
+			}
+			l.renameTable(mp, mp.TableSchema, newName)
+			return nil
+		}
+		if p.acceptKeywords("constraint") {
+			oldName, err := p.ident()
+			if err != nil {
+				return err
+			}
+			if err = p.expectKeywords("to"); err != nil {
+				return err
+			}
+			newName, err := p.ident()
+			if err != nil {
+				return err
+			}
+			for i := range mp.Constraints {
+				if mp.Constraints[i].Name == oldName {
+					mp.Constraints[i].Name = newName
+				}
+			}
+			return nil
+		}
+		p.acceptKeywords("column")
+		oldName, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if err = p.expectKeywords("to"); err != nil {
+			return err
+		}
+		newName, err := p.ident()
+		if err != nil {
+			return err
+		}
+		l.renameColumn(mp, oldName, newName)
+		return nil
+	case p.acceptKeywords("set", "schema"):
+		newSchema, err := p.ident()
+		if err != nil {
+			return err
+		}
+		l.renameTable(mp, newSchema, mp.TableName)
+		return nil
+	}
+	p.skipExpr()
+	return nil
+}
+
+func (l *ddlLoader) dropTable(p *ddlParser) error {
+	p.acceptKeywords("if", "exists")
+	for {
+		schema, name, err := p.qualifiedName()
+		if err != nil {
+			return err
+		}
+		delete(l.tables, schema+"."+name)
+		// Foreign keys referring to a dropped table go with it (CASCADE)
+		for _, mp := range l.tables {
+			cons := mp.Constraints[:0]
+			for _, con := range mp.Constraints {
+				if !(con.Type == "FOREIGN KEY" && con.RefSchema == schema && con.RefTable == name) {
+					cons = append(cons, con)
+				}
+			}
+			mp.Constraints = cons
+		}
+		if !p.acceptPunct(",") {
+			return nil
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *ddlLoader) dropConstraint(mp *TableMap, conName string) {
+	cons := mp.Constraints[:0]
+	for _, con := range mp.Constraints {
+		if con.Name != conName {
+			cons = append(cons, con)
+		}
+	}
+	mp.Constraints = cons
+}
+
+// dropColumn - removes the column along with the constraints and indexes
+// that use it
+func (l *ddlLoader) dropColumn(mp *TableMap, colName string) {
+	i := mp.colIndex(colName)
+	if i < 0 {
+		return
+	}
+	mp.colDesc = append(mp.colDesc[:i], mp.colDesc[i+1:]...)
+	cons := mp.Constraints[:0]
+	for _, con := range mp.Constraints {
+		if !containsString(con.Columns, colName) {
+			cons = append(cons, con)
+		}
+	}
+	mp.Constraints = cons
+	indexes := mp.Indexes[:0]
+	for _, idx := range mp.Indexes {
+		if !containsString(idx.Columns, colName) {
+			indexes = append(indexes, idx)
+		}
+	}
+	mp.Indexes = indexes
+}
+
+func renameInList(list []string, oldName string, newName string) {
+	for i := range list {
+		if list[i] == oldName {
+			list[i] = newName
+		}
+	}
+}
+
+func (l *ddlLoader) renameColumn(mp *TableMap, oldName string, newName string) {
+	if i := mp.colIndex(oldName); i >= 0 {
+		mp.colDesc[i].ColumnName = newName
+	}
+	for i := range mp.Constraints {
+		renameInList(mp.Constraints[i].Columns, oldName, newName)
+	}
+	for i := range mp.Indexes {
+		renameInList(mp.Indexes[i].Columns, oldName, newName)
+	}
+	for _, other := range l.tables {
+		for i := range other.Constraints {
+			con := &other.Constraints[i]
+			if con.Type == "FOREIGN KEY" && con.RefSchema == mp.TableSchema && con.RefTable == mp.TableName {
+				renameInList(con.RefColumns, oldName, newName)
+			}
+		}
+	}
+}
+
+func (l *ddlLoader) renameTable(mp *TableMap, newSchema string, newName string) {
+	for _, other := range l.tables {
+		for i := range other.Constraints {
+			con := &other.Constraints[i]
+			if con.Type == "FOREIGN KEY" && con.RefSchema == mp.TableSchema && con.RefTable == mp.TableName {
+				con.RefSchema = newSchema
+				con.RefTable = newName
+			}
+		}
+	}
+	delete(l.tables, mp.QualifiedName())
+	mp.TableSchema = newSchema
+	mp.TableName = newName
+	for i := range mp.colDesc {
+		mp.colDesc[i].TableSchema = newSchema
+		mp.colDesc[i].TableName = newName
+	}
+	l.tables[mp.QualifiedName()] = mp
+}
+
+// constraintDef - the definition as pg_get_constraintdef would print it
+func constraintDef(con ConstraintDesc) string {
+	cols := strings.Join(con.Columns, ", ")
+	switch con.Type {
+	case "PRIMARY KEY", "UNIQUE":
+		return fmt.Sprintf("%s (%s)", con.Type, cols)
+	case "FOREIGN KEY":
+		return fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s.%s(%s)", cols, con.RefSchema,
+			con.RefTable, strings.Join(con.RefColumns, ", "))
+	}
+	return con.Definition
+}
+
+// finalize - resolves foreign keys, derives key membership and the indexes
+// backing primary keys and unique constraints, and builds the column
+// summaries of all tables in the given schemas
+func (l *ddlLoader) finalize(schemas []string) *DBMeta {
+	meta := DBMeta{Tables: map[string]*TableMap{}, Queries: map[string]QueryMeta{}, Enums: l.enums,
+		Composites: l.composites, Domains: l.domains}
+	for _, c := range l.composites {
+		for i := range c.Attributes {
+			if c.Attributes[i].TypeKind == "" {
+				c.Attributes[i].TypeKind = l.typeKind(&c.Attributes[i])
+			}
+		}
+	}
+	for _, d := range l.domains {
+		if d.BaseType.TypeKind == "" {
+			d.BaseType.TypeKind = l.typeKind(&d.BaseType)
+		}
+	}
+	for _, mp := range l.tables {
+		for i := range mp.Constraints {
+			con := &mp.Constraints[i]
+			if con.Type == "FOREIGN KEY" && len(con.RefColumns) == 0 {
+				// A foreign key without columns refers to the primary key
+				if ref := l.table(con.RefSchema, con.RefTable); ref != nil {
+					if pk := ref.primaryKey(); pk != nil {
+						con.RefColumns = append([]string{}, pk.Columns...)
+					}
+				}
+			}
+		}
+	}
+	for key, mp := range l.tables {
+		if !containsString(schemas, mp.TableSchema) {
+			continue
+		}
+		constraints := mp.Constraints
+		sort.SliceStable(constraints, func(i, j int) bool {
+			return constraints[i].Name < constraints[j].Name
+		})
+		mp.Constraints = make([]ConstraintDesc, 0)
+		for i := range mp.colDesc {
+			col := &mp.colDesc[i]
+			col.Keys = nil
+			if col.TypeKind == "" {
+				col.TypeKind = l.typeKind(col)
+			}
+		}
+		indexes := mp.Indexes
+		for _, con := range constraints {
+			if con.Type == "PRIMARY KEY" {
+				for _, colName := range con.Columns {
+					if i := mp.colIndex(colName); i >= 0 {
+						mp.colDesc[i].IsNullable = false
+					}
+				}
+			}
+			if con.Type == "PRIMARY KEY" || con.Type == "UNIQUE" {
+				indexes = append(indexes, IndexDesc{Name: con.Name, Method: "btree", IsUnique: true,
+					IsPrimary: con.Type == "PRIMARY KEY", Columns: con.Columns})
+			}
+			con.Definition = constraintDef(con)
+			mp.addConstraint(con)
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return indexes[i].Name < indexes[j].Name
+		})
+		mp.Indexes = indexes
+		meta.Tables[key] = mp
+	}
+	meta.prepare()
+	return &meta
+}
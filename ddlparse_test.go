@@ -0,0 +1,419 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//=========   pg_catalog side   ===========
+
+// catalogTable - a public table as the queries of ProcessColMetadata read it
+// from pg_catalog, i.e. columns by attnum, constraints and indexes by name
+type catalogTable struct {
+	name    string
+	cols    []ColDesc
+	cons    []ConstraintDesc
+	indexes []IndexDesc
+}
+
+// catalogTypes - format_type, oid and array oid of the built in types used below
+var catalogTypes = map[string]struct {
+	dataType string
+	oid      uint32
+	arrayOID uint32
+}{
+	"bool":        {"boolean", 16, 1000},
+	"int4":        {"integer", 23, 1007},
+	"int8":        {"bigint", 20, 1016},
+	"text":        {"text", 25, 1009},
+	"varchar":     {"character varying", 1043, 1015},
+	"numeric":     {"numeric", 1700, 1231},
+	"timestamptz": {"timestamp with time zone", 1184, 1185},
+}
+
+// catalogCol - a column of a built in type. def is the default as given by
+// pg_get_expr, "" for none
+func catalogCol(pos int, name string, typName string, typMod int32, nullable bool, def string) ColDesc {
+	t := catalogTypes[typName]
+	return ColDesc{ColumnName: name, DataType: t.dataType, ColumnDefault: def, IsNullable: nullable,
+		OrdinalPosition: pos, TypeOID: t.oid, TypeMod: typMod, TypeName: typName,
+		TypeSchema: "pg_catalog", TypeKind: "b"}
+}
+
+// catalogArrayCol - a one dimensional array column of a built in type
+func catalogArrayCol(pos int, name string, elemName string, nullable bool) ColDesc {
+	t := catalogTypes[elemName]
+	return ColDesc{ColumnName: name, DataType: "ARRAY", IsNullable: nullable, OrdinalPosition: pos,
+		TypeOID: t.arrayOID, TypeMod: -1, TypeName: "_" + elemName, TypeSchema: "pg_catalog",
+		TypeKind: "b", ElemTypeOID: t.oid, Dimensions: 1}
+}
+
+// identityCol - the column as a GENERATED ... AS IDENTITY column, which
+// pg_attrdef has no default for
+func identityCol(col ColDesc) ColDesc {
+	col.IsIdentity = true
+	return col
+}
+
+// catalogMeta - the DBMeta LoadDBMeta builds from the catalog rows of tables
+func catalogMeta(tables []catalogTable) *DBMeta {
+	meta := DBMeta{Tables: map[string]*TableMap{}, Queries: map[string]QueryMeta{},
+		Enums: map[string]*EnumDesc{}, Composites: map[string]*CompositeDesc{},
+		Domains: map[string]*DomainDesc{}}
+	for _, ct := range tables {
+		mp := CreateNewTablemap("public", ct.name)
+		for _, col := range ct.cols {
+			col.TableSchema = mp.TableSchema
+			col.TableName = mp.TableName
+			mp.colDesc = append(mp.colDesc, col)
+		}
+		for _, con := range ct.cons {
+			// confkey is NULL for all but foreign keys, which the query reads as {}
+			if con.RefColumns == nil {
+				con.RefColumns = []string{}
+			}
+			mp.addConstraint(con)
+		}
+		mp.Indexes = append(mp.Indexes, ct.indexes...)
+		meta.Tables[mp.QualifiedName()] = mp
+	}
+	meta.prepare()
+	return &meta
+}
+
+// pkey - the PRIMARY KEY constraint and the index backing it
+func pkey(name string, cols ...string) (ConstraintDesc, IndexDesc) {
+	return ConstraintDesc{Name: name, Type: "PRIMARY KEY", Columns: cols},
+		IndexDesc{Name: name, Method: "btree", IsUnique: true, IsPrimary: true, Columns: cols}
+}
+
+// uniqueKey - the UNIQUE constraint and the index backing it
+func uniqueKey(name string, cols ...string) (ConstraintDesc, IndexDesc) {
+	return ConstraintDesc{Name: name, Type: "UNIQUE", Columns: cols},
+		IndexDesc{Name: name, Method: "btree", IsUnique: true, Columns: cols}
+}
+
+// fkey - a FOREIGN KEY constraint to a public table
+func fkey(name string, cols []string, refTable string, refCols ...string) ConstraintDesc {
+	return ConstraintDesc{Name: name, Type: "FOREIGN KEY", Columns: cols, RefSchema: "public",
+		RefTable: refTable, RefColumns: refCols}
+}
+
+//=========   Comparison   ===========
+
+// catalogView - what the generator takes from a table. Defaults and the
+// expressions of CHECK constraints are normalized by pg_get_expr and
+// pg_get_constraintdef, so only the presence of a default is compared, and
+// constraint definitions not at all
+type catalogView struct {
+	Kind        string
+	Columns     []ColDesc
+	Constraints []ConstraintDesc
+	Indexes     []IndexDesc
+	Summary     ColSummary
+}
+
+func viewOf(mp *TableMap) catalogView {
+	v := catalogView{Kind: mp.Kind, Indexes: mp.Indexes, Summary: mp.colSummary}
+	for _, col := range mp.colDesc {
+		if col.ColumnDefault != "" {
+			col.ColumnDefault = "DEFAULT"
+		}
+		v.Columns = append(v.Columns, col)
+	}
+	for _, con := range mp.Constraints {
+		con.Definition = ""
+		v.Constraints = append(v.Constraints, con)
+	}
+	return v
+}
+
+// loadDDL - replays the migration files, named by their order, through
+// LoadDDLMeta
+func loadDDL(t *testing.T, files []string) *DBMeta {
+	dir := t.TempDir()
+	for i, src := range files {
+		name := filepath.Join(dir, fmt.Sprintf("%03d_migration.sql", i+1))
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := LoadDDLMeta(dir, []string{"public"})
+	if meta == nil {
+		t.Fatal("LoadDDLMeta failed")
+	}
+	return meta
+}
+
+//=========   Cases   ===========
+
+func TestLoadDDLMeta(t *testing.T) {
+	orderItemPkey, orderItemPkeyIdx := pkey("Order Item_pkey", "Id")
+	notePkey, notePkeyIdx := pkey("note_pkey", "id")
+	customerPkey, customerPkeyIdx := pkey("customer_pkey", "id")
+	customerKey, customerKeyIdx := uniqueKey("customer_region_code_key", "region", "code")
+	ordersPkey, ordersPkeyIdx := pkey("orders_pkey", "id")
+	accountPkey, accountPkeyIdx := pkey("account_pkey", "id")
+	accountNick, accountNickIdx := uniqueKey("account_nick_key", "nick")
+	clientPkey, clientPkeyIdx := pkey("client_pkey", "customer_id")
+	invoicePkey, invoicePkeyIdx := pkey("invoice_pkey", "id")
+	postPkey, postPkeyIdx := pkey("post_pkey", "id")
+	postTagPkey, postTagPkeyIdx := pkey("post_tag_pkey", "post_id", "tag_id")
+
+	tests := []struct {
+		name    string
+		files   []string
+		catalog []catalogTable
+	}{
+		{
+			name: "quoted identifiers",
+			files: []string{`
+				CREATE TABLE "Order Item" (
+					"Id" serial PRIMARY KEY,
+					"unitPrice" numeric(10, 2) NOT NULL,
+					"select" text,
+					Quantity INT DEFAULT 1,
+					"Tags" TEXT[],
+					CONSTRAINT "Price Positive" CHECK ("unitPrice" > 0)
+				);
+				CREATE UNIQUE INDEX "Item Select" ON "Order Item" ("select");
+				`},
+			catalog: []catalogTable{{
+				name: "Order Item",
+				cols: []ColDesc{
+					catalogCol(1, "Id", "int4", -1, false, `nextval('"Order Item_Id_seq"'::regclass)`),
+					catalogCol(2, "unitPrice", "numeric", (10<<16|2)+4, false, ""),
+					catalogCol(3, "select", "text", -1, true, ""),
+					catalogCol(4, "quantity", "int4", -1, true, "1"),
+					catalogArrayCol(5, "Tags", "text", true),
+				},
+				cons: []ConstraintDesc{
+					orderItemPkey,
+					{Name: "Price Positive", Type: "CHECK", Columns: []string{"unitPrice"}},
+				},
+				indexes: []IndexDesc{
+					{Name: "Item Select", Method: "btree", IsUnique: true, Columns: []string{"select"}},
+					orderItemPkeyIdx,
+				},
+			}},
+		},
+		{
+			name: "dollar quoted defaults",
+			files: []string{`
+				create function touch() returns trigger as $$
+				begin
+					create table fake (x int);
+					return new;
+				end
+				$$ language plpgsql;
+				create table note (
+					id bigint generated by default as identity primary key,
+					body text not null default $$it's; a (note)$$,
+					tag varchar(20) default $tag$ $$ inner $tag$,
+					done boolean not null default false
+				);
+				`},
+			catalog: []catalogTable{{
+				name: "note",
+				cols: []ColDesc{
+					identityCol(catalogCol(1, "id", "int8", -1, false, "")),
+					catalogCol(2, "body", "text", -1, false, `'it''s; a (note)'::text`),
+					catalogCol(3, "tag", "varchar", 24, true, `' $$ inner '::character varying`),
+					catalogCol(4, "done", "bool", -1, false, "false"),
+				},
+				cons:    []ConstraintDesc{notePkey},
+				indexes: []IndexDesc{notePkeyIdx},
+			}},
+		},
+		{
+			name: "composite and inline foreign keys",
+			files: []string{`
+				create table customer (
+					id serial primary key,
+					region text not null,
+					code int not null,
+					unique (region, code)
+				);
+				create table orders (
+					id serial primary key,
+					customer_id int not null references customer,
+					region text,
+					code int,
+					parent_id int references orders (id) on delete cascade,
+					constraint orders_customer_fk foreign key (region, code)
+						references customer (region, code) on update cascade
+				);
+				`},
+			catalog: []catalogTable{{
+				name: "customer",
+				cols: []ColDesc{
+					catalogCol(1, "id", "int4", -1, false, "nextval('customer_id_seq'::regclass)"),
+					catalogCol(2, "region", "text", -1, false, ""),
+					catalogCol(3, "code", "int4", -1, false, ""),
+				},
+				cons:    []ConstraintDesc{customerPkey, customerKey},
+				indexes: []IndexDesc{customerPkeyIdx, customerKeyIdx},
+			}, {
+				name: "orders",
+				cols: []ColDesc{
+					catalogCol(1, "id", "int4", -1, false, "nextval('orders_id_seq'::regclass)"),
+					catalogCol(2, "customer_id", "int4", -1, false, ""),
+					catalogCol(3, "region", "text", -1, true, ""),
+					catalogCol(4, "code", "int4", -1, true, ""),
+					catalogCol(5, "parent_id", "int4", -1, true, ""),
+				},
+				cons: []ConstraintDesc{
+					fkey("orders_customer_fk", []string{"region", "code"}, "customer", "region", "code"),
+					fkey("orders_customer_id_fkey", []string{"customer_id"}, "customer", "id"),
+					fkey("orders_parent_id_fkey", []string{"parent_id"}, "orders", "id"),
+					ordersPkey,
+				},
+				indexes: []IndexDesc{ordersPkeyIdx},
+			}},
+		},
+		{
+			name: "alter table add and drop column",
+			files: []string{`
+				create table account (
+					id int primary key,
+					legacy text,
+					email text,
+					kind text,
+					unique (email, legacy)
+				);
+				create index account_kind_idx on account (kind);
+				create index account_legacy_idx on account (legacy, kind);
+				`, `
+				alter table account add column created timestamptz not null default now();
+				alter table account drop column legacy;
+				alter table account add column if not exists email text, add column nick varchar(30) unique;
+				alter table account drop column kind, add column n bigint generated always as identity;
+				alter table account drop column n;
+				alter table account add score int;
+				`},
+			catalog: []catalogTable{{
+				name: "account",
+				cols: []ColDesc{
+					catalogCol(1, "id", "int4", -1, false, ""),
+					catalogCol(3, "email", "text", -1, true, ""),
+					catalogCol(5, "created", "timestamptz", -1, false, "now()"),
+					catalogCol(6, "nick", "varchar", 34, true, ""),
+					catalogCol(8, "score", "int4", -1, true, ""),
+				},
+				cons:    []ConstraintDesc{accountNick, accountPkey},
+				indexes: []IndexDesc{accountNickIdx, accountPkeyIdx},
+			}},
+		},
+		{
+			name: "rename",
+			files: []string{`
+				create table client (id serial primary key, name text not null);
+				create table invoice (
+					id serial primary key,
+					client_id int references client,
+					amount numeric
+				);
+				create index invoice_client_idx on invoice (client_id);
+				alter table client rename to customer;
+				alter table customer rename column id to customer_id;
+				alter table invoice rename column client_id to customer_id;
+				alter table invoice rename constraint invoice_client_id_fkey to invoice_customer_fk;
+				alter table invoice rename amount to total;
+				`},
+			catalog: []catalogTable{{
+				name: "customer",
+				cols: []ColDesc{
+					catalogCol(1, "customer_id", "int4", -1, false, "nextval('client_id_seq'::regclass)"),
+					catalogCol(2, "name", "text", -1, false, ""),
+				},
+				cons:    []ConstraintDesc{clientPkey},
+				indexes: []IndexDesc{clientPkeyIdx},
+			}, {
+				name: "invoice",
+				cols: []ColDesc{
+					catalogCol(1, "id", "int4", -1, false, "nextval('invoice_id_seq'::regclass)"),
+					catalogCol(2, "customer_id", "int4", -1, true, ""),
+					catalogCol(3, "total", "numeric", -1, true, ""),
+				},
+				cons: []ConstraintDesc{
+					fkey("invoice_customer_fk", []string{"customer_id"}, "customer", "customer_id"),
+					invoicePkey,
+				},
+				indexes: []IndexDesc{
+					{Name: "invoice_client_idx", Method: "btree", Columns: []string{"customer_id"}},
+					invoicePkeyIdx,
+				},
+			}},
+		},
+		{
+			name: "drop if exists",
+			files: []string{`
+				drop table if exists nothing_here;
+				create table tag (id int primary key, label text);
+				create table post (id int primary key, title text);
+				create table post_tag (
+					post_id int references post,
+					tag_id int references tag,
+					primary key (post_id, tag_id)
+				);
+				alter table post drop column if exists missing;
+				alter table post_tag drop constraint if exists no_such_constraint;
+				drop table if exists tag, nothing_either cascade;
+				`},
+			catalog: []catalogTable{{
+				name: "post",
+				cols: []ColDesc{
+					catalogCol(1, "id", "int4", -1, false, ""),
+					catalogCol(2, "title", "text", -1, true, ""),
+				},
+				cons:    []ConstraintDesc{postPkey},
+				indexes: []IndexDesc{postPkeyIdx},
+			}, {
+				name: "post_tag",
+				cols: []ColDesc{
+					catalogCol(1, "post_id", "int4", -1, false, ""),
+					catalogCol(2, "tag_id", "int4", -1, false, ""),
+				},
+				cons: []ConstraintDesc{
+					postTagPkey,
+					fkey("post_tag_post_id_fkey", []string{"post_id"}, "post", "id"),
+				},
+				indexes: []IndexDesc{postTagPkeyIdx},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := loadDDL(t, tt.files)
+			want := catalogMeta(tt.catalog)
+			if len(got.Tables) != len(want.Tables) {
+				t.Errorf("got tables %v, want %v", got.sortedTableNames(), want.sortedTableNames())
+			}
+			for _, name := range want.sortedTableNames() {
+				mp, ok := got.Tables[name]
+				if !ok {
+					t.Errorf("table %s missing", name)
+					continue
+				}
+				gotView, wantView := viewOf(mp), viewOf(want.Tables[name])
+				if !reflect.DeepEqual(gotView.Columns, wantView.Columns) {
+					t.Errorf("%s columns\n got  %+v\n want %+v", name, gotView.Columns, wantView.Columns)
+				}
+				if !reflect.DeepEqual(gotView.Constraints, wantView.Constraints) {
+					t.Errorf("%s constraints\n got  %+v\n want %+v", name, gotView.Constraints, wantView.Constraints)
+				}
+				if !reflect.DeepEqual(gotView.Indexes, wantView.Indexes) {
+					t.Errorf("%s indexes\n got  %+v\n want %+v", name, gotView.Indexes, wantView.Indexes)
+				}
+				if gotView.Kind != wantView.Kind || !reflect.DeepEqual(gotView.Summary, wantView.Summary) {
+					t.Errorf("%s summary\n got  %s %+v\n want %s %+v", name, gotView.Kind, gotView.Summary,
+						wantView.Kind, wantView.Summary)
+				}
+			}
+		})
+	}
+}
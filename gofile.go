@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// generatedHeader - the header of every generated file, marking it as
+// generated for linters and reviewers
+func generatedHeader(fingerprint string) string {
+	return fmt.Sprintf("// Code generated by pgx-daogen %s. DO NOT EDIT.\n// Schema fingerprint: %s\n\n",
+		daogenVersion, fingerprint)
+}
+
+// formatGoFile - parses the generated source, removes the imports it does
+// not use, groups the others and formats it by go/format, after the header.
+// Returns an error if the source does not parse. fileName is only used in
+// error messages
+func formatGoFile(fileName string, header string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, append([]byte(header), src...), parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	pruneImports(fset, file)
+	var buf bytes.Buffer
+	if err = format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return groupImports(buf.Bytes())
+}
+
+// groupImports - rewrites the import block of the formatted source as
+// goimports has it: the standard library imports first, then the others,
+// each group sorted by path and separated by a blank line. The source is
+// formatted once more, which also closes the gaps left by removed imports
+func groupImports(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT || !gen.Lparen.IsValid() {
+			continue
+		}
+		// Paths of the standard library have no dot in the first element
+		groups := [2][]*ast.ImportSpec{}
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			path, _ := strconv.Unquote(imp.Path.Value)
+			if strings.Contains(strings.Split(path, "/")[0], ".") {
+				groups[1] = append(groups[1], imp)
+			} else {
+				groups[0] = append(groups[0], imp)
+			}
+		}
+		block := "(\n"
+		for _, group := range groups {
+			if len(group) == 0 {
+				continue
+			}
+			if len(block) > 2 {
+				block += "\n"
+			}
+			sort.SliceStable(group, func(i, j int) bool {
+				return group[i].Path.Value < group[j].Path.Value
+			})
+			for _, imp := range group {
+				block += "\t"
+				if imp.Name != nil {
+					block += imp.Name.Name + " "
+				}
+				block += imp.Path.Value + "\n"
+			}
+		}
+		block += ")"
+		start := fset.Position(gen.Lparen).Offset
+		end := fset.Position(gen.Rparen).Offset + 1
+		src = append(append(append([]byte{}, src[:start]...), block...), src[end:]...)
+		break
+	}
+	return format.Source(src)
+}
+
+// pruneImports - removes the imports whose package name is not used by the
+// file, and imports given twice, e.g. by a template and for a VO type. Blank
+// and dot imports are kept
+func pruneImports(fset *token.FileSet, file *ast.File) {
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	isUsed := func(spec *ast.ImportSpec) bool {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := importName(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		return name == "_" || name == "." || used[name]
+	}
+
+	seen := map[string]bool{}
+	imports := []*ast.ImportSpec{}
+	decls := []ast.Decl{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			decls = append(decls, decl)
+			continue
+		}
+		specs := []ast.Spec{}
+		removed := []ast.Spec{}
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			key := imp.Path.Value
+			if imp.Name != nil {
+				key = imp.Name.Name + " " + key
+			}
+			if isUsed(imp) && !seen[key] {
+				seen[key] = true
+				specs = append(specs, spec)
+				imports = append(imports, imp)
+			} else {
+				removed = append(removed, spec)
+			}
+		}
+		// The line of a removed import is joined with the next line, so that
+		// it leaves no blank line. Done from the last one, as joining renumbers
+		// the lines after it
+		if gen.Rparen.IsValid() {
+			tf := fset.File(gen.Rparen)
+			for i := len(removed) - 1; i >= 0; i-- {
+				line := fset.Position(removed[i].Pos()).Line
+				if line < fset.Position(gen.Rparen).Line {
+					tf.MergeLine(line)
+				}
+			}
+		}
+		if len(specs) > 0 {
+			gen.Specs = specs
+			decls = append(decls, gen)
+		}
+	}
+	file.Decls = decls
+	file.Imports = imports
+}
+
+var versionElem = regexp.MustCompile(`^v[0-9]+$`)
+
+// importName - the package name assumed for an import path: the last
+// element, without a major version element (pgx/v5 is pgx), a go- prefix
+// or anything from the first character not allowed in an identifier
+// (yaml.v3 is yaml)
+func importName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if versionElem.MatchString(name) && len(elems) > 1 {
+		name = elems[len(elems)-2]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	if i := strings.IndexFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
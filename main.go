@@ -2,13 +2,19 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
 )
 
 var configFileName = "godao.config"
 
+// daogenVersion - the version of pgx-daogen, given in the generated files
+const daogenVersion = "1.0.0"
+
 func genConfigFile() {
 	f, err := os.Create(configFileName)
 	if err != nil {
@@ -22,6 +28,9 @@ func genConfigFile() {
 "Dbname" : "mydb",
 "Username" : "dbuser",
 "Password" : "dbpwd",
+"Schemas" : [
+	"public"
+],
 "Tables" : [
 	"*"
 ],
@@ -38,70 +47,360 @@ func genConfigFile() {
 	f.Close()
 }
 
-func processGodaoFile() {
-	v := GetGenData(configFileName)
-	os.MkdirAll(v.PackageName, 0755)
-	dbase, _ := CreateConnection(v.Hostname, v.Dbname, v.Username, v.Password, 5)
+// loadMeta - reads the metadata from the migrations directory when one is
+// configured, otherwise from the database
+func loadMeta(v *Genstruct) *DBMeta {
+	if len(v.MigrationsDir) > 0 {
+		meta := LoadDDLMeta(v.MigrationsDir, v.Schemas)
+		if meta != nil && len(v.Queries) > 0 {
+			fmt.Println("***WARNING***", "Query objects need a database or a snapshot, skipping queries")
+		}
+		return meta
+	}
+	dbase, err := CreateConnection(v.Hostname, v.Dbname, v.Username, v.Password, 5)
+	if err != nil {
+		fmt.Printf("***ERROR*** : Connecting to database %s on host %s. Error = %v\n", v.Dbname, v.Hostname, err)
+		return nil
+	}
 	defer dbase.Close()
 	fmt.Printf("Connection worked!\n")
-	t := ProcessColMetadata(dbase)
-	if t == nil {
+	return LoadDBMeta(dbase, v)
+}
+
+// inspectDatabase - introspects the database and writes the snapshot file
+func inspectDatabase(snapshotFile string) {
+	v := GetGenData(configFileName)
+	meta := loadMeta(v)
+	if meta == nil {
+		os.Exit(1)
+	}
+	if err := WriteSnapshot(meta, snapshotFile); err != nil {
+		fmt.Println("***ERROR*** : Writing snapshot. Error = ", err)
 		os.Exit(1)
 	}
-	fmt.Println("***   GENERATING RECORD SETS   ***")
-	for tableName, tableMap := range t {
+	fmt.Printf("Snapshot of %d tables and %d queries written to %s\n",
+		len(meta.Tables), len(meta.Queries), snapshotFile)
+}
+
+// loadConfiguredMeta - reads the config file and the metadata, from the
+// database or, when snapshotFile is given, from a snapshot without
+// connecting to the database
+func loadConfiguredMeta(snapshotFile string) (*Genstruct, *DBMeta) {
+	v := GetGenData(configFileName)
+	var meta *DBMeta
+	if len(snapshotFile) > 0 {
+		var err error
+		meta, err = ReadSnapshot(snapshotFile)
+		if err != nil {
+			fmt.Println("***ERROR*** : Reading snapshot. Error = ", err)
+			os.Exit(1)
+		}
+	} else {
+		meta = loadMeta(v)
+	}
+	if meta == nil {
+		os.Exit(1)
+	}
+	if err := meta.configure(v); err != nil {
+		fmt.Println("***ERROR*** : Config file. Error = ", err)
+		os.Exit(1)
+	}
+	return v, meta
+}
+
+// processGodaoFile - generates the code, from the database or, when
+// snapshotFile is given, from a snapshot without connecting to the database
+func processGodaoFile(snapshotFile string) {
+	v, meta := loadConfiguredMeta(snapshotFile)
+	generateCode(v, meta)
+}
+
+// checkGodaoFile - checks that the generated code on disk is up to date.
+// Exits with 1 if it is not
+func checkGodaoFile(snapshotFile string) {
+	v, meta := loadConfiguredMeta(snapshotFile)
+	files, ok := renderCode(v, meta, false)
+	if !ok {
+		os.Exit(1)
+	}
+	if !checkCode(v.PackageName, files) {
+		os.Exit(1)
+	}
+	fmt.Println("Generated code in", v.PackageName, "is up to date")
+}
+
+// generatedFile - a generated file, rendered in memory
+type generatedFile struct {
+	name string
+	src  []byte
+}
+
+func generateCode(v *Genstruct, meta *DBMeta) {
+	files, ok := renderCode(v, meta, true)
+	os.MkdirAll(v.PackageName, 0755)
+	for _, f := range files {
+		if err := ioutil.WriteFile(v.PackageName+"/"+f.name, f.src, 0644); err != nil {
+			fmt.Println("***ERROR***", "Writing", f.name, "Error =", err)
+			ok = false
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// renderCode - generates all files into memory, printing the progress if
+// verbose. Only files that parse are returned. Generation carries on with the
+// other files after an error, but false is returned
+func renderCode(v *Genstruct, meta *DBMeta, verbose bool) ([]generatedFile, bool) {
+	progress := func(args ...interface{}) {
+		if verbose {
+			fmt.Print(args...)
+		}
+	}
+	selected := map[string]*TableMap{}
+	for tableName, tableMap := range meta.Tables {
 		tableTobeProcessed := false
 		if v.Tables[0] == "*" {
 			tableTobeProcessed = true
 		} else {
+			// Tables can be given either bare or schema qualified
 			for _, table := range v.Tables {
-				if tableName == table {
+				if tableName == table || tableMap.TableName == table {
 					tableTobeProcessed = true
 					break
 				}
 			}
 		}
-		if !tableTobeProcessed {
+		if tableTobeProcessed {
+			selected[tableName] = tableMap
+		}
+	}
+	linkRelations(selected)
+	tableNames := []string{}
+	for tableName := range selected {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	header := generatedHeader(meta.fingerprint(selected, v.Queries))
+
+	// User defined types and array conversions are generated once for every
+	// table and query that uses them
+	used := newUsedTypes()
+	for _, tableMap := range selected {
+		for i := range tableMap.colDesc {
+			used.addUsedTypes(&tableMap.colDesc[i].goInfo)
+		}
+	}
+	for _, q := range v.Queries {
+		if qm, ok := meta.Queries[q.Name]; ok {
+			for i := range qm.Columns {
+				used.addUsedTypes(&qm.Columns[i].goInfo)
+			}
+		}
+	}
+	if !checkColTypes(v, meta, selected, used) {
+		return nil, false
+	}
+
+	tmpl, err := loadTemplates(v.TemplateDir, meta.target())
+	if err != nil {
+		fmt.Println("***ERROR*** : Templates. Error = ", err)
+		return nil, false
+	}
+
+	files := []generatedFile{}
+	ok := true
+	progress("***   GENERATING RECORD SETS   ***\n")
+	for _, tableName := range tableNames {
+		tableMap := selected[tableName]
+		progress(tableName)
+		var buf bytes.Buffer
+		_global_writer = bufio.NewWriter(&buf)
+		err := generateProgram(tmpl, v.PackageName, tableMap)
+		var src []byte
+		if err == nil {
+			src, err = formatGoFile(v.PackageName+"/"+tableMap.FileName(), header, buf.Bytes())
+		}
+		if err != nil {
+			progress("\n")
+			fmt.Println("***ERROR***", "Generating table", tableName, "Error =", err)
+			ok = false
 			continue
 		}
-		fmt.Print(tableName)
-		globalfp, _ := os.Create(v.PackageName + "/" + tableName + "Recordset.go")
-		_global_writer = bufio.NewWriter(globalfp)
-		ff("package %s\n\n", v.PackageName)
-		generateProgram(tableName, tableMap)
-		globalfp.Close()
-		fmt.Println(" ... Completed.")
+		files = append(files, generatedFile{tableMap.FileName(), src})
+		progress(" ... Completed.\n")
 	}
 
-	fmt.Println("\n***   GENERATING QUERY OBJECTS   ***")
+	progress("\n***   GENERATING QUERY OBJECTS   ***\n")
 	for _, q := range v.Queries {
-		cols := getQueryObject(dbase, q)
-		if cols == nil {
+		qm, found := meta.Queries[q.Name]
+		if !found {
+			fmt.Println("***ERROR***", "No column information for query", q.Name)
+			continue
+		}
+		if qm.Query != q.Query {
+			fmt.Println("***ERROR***", "Query", q.Name, "has changed since the snapshot was taken")
 			continue
 		}
 		goQueryName := convertCase(q.Name)
-		fmt.Print(goQueryName)
-		globalfp, _ := os.Create(v.PackageName + "/" + goQueryName + "QO.go")
-		_global_writer = bufio.NewWriter(globalfp)
+		progress(goQueryName)
+		var buf bytes.Buffer
+		_global_writer = bufio.NewWriter(&buf)
+		err := genQueryObject(tmpl, v.PackageName, q, qm.Columns)
+		var src []byte
+		if err == nil {
+			src, err = formatGoFile(v.PackageName+"/"+goQueryName+"QO.go", header, buf.Bytes())
+		}
+		if err != nil {
+			progress("\n")
+			fmt.Println("***ERROR***", "Generating query", q.Name, "Error =", err)
+			ok = false
+			continue
+		}
+		files = append(files, generatedFile{goQueryName + "QO.go", src})
+		progress(" ... Completed.\n")
+	}
+
+	// pgx v5 and database/sql code come with their DBase, pgdb.go is for
+	// pgx v3 only
+	if len(meta.target()) > 0 {
+		var buf bytes.Buffer
+		err := executeTemplate(&buf, tmpl, "dbase", v.PackageName)
+		var src []byte
+		if err == nil {
+			src, err = formatGoFile(v.PackageName+"/DBase.go", header, buf.Bytes())
+		}
+		if err != nil {
+			fmt.Println("***ERROR***", "Generating DBase", "Error =", err)
+			ok = false
+		} else {
+			files = append(files, generatedFile{"DBase.go", src})
+		}
+	}
+
+	if !used.isEmpty() {
+		progress("\n***   GENERATING USER DEFINED TYPES   ***\n")
+		var buf bytes.Buffer
+		_global_writer = bufio.NewWriter(&buf)
 		ff("package %s\n\n", v.PackageName)
-		genQueryObject(q, cols)
-		globalfp.Close()
-		fmt.Println(" ... Completed.")
+		genUserTypes(meta, used)
+		src, err := formatGoFile(v.PackageName+"/Types.go", header, buf.Bytes())
+		if err != nil {
+			fmt.Println("***ERROR***", "Generating user defined types", "Error =", err)
+			ok = false
+		} else {
+			files = append(files, generatedFile{"Types.go", src})
+			progress("Types.go ... Completed.\n")
+		}
+	}
+	return files, ok
+}
+
+// checkColTypes - reports every generated column whose type has no go
+// mapping. These are held as text and only give a warning, unless StrictTypes
+// is set in the config. Types the pgx version can not handle are always an
+// error. Returns false if generation has to stop
+func checkColTypes(v *Genstruct, meta *DBMeta, selected map[string]*TableMap, used *usedTypes) bool {
+	problems := []string{}
+	unsupported := []string{}
+	check := func(col *ColDesc, owner string) {
+		if t := col.goInfo.unsupportedType(); len(t) > 0 {
+			unsupported = append(unsupported, fmt.Sprintf("Column %s of %s: %s is not supported with %s",
+				col.ColumnName, owner, t, meta.targetName()))
+		}
+		if t := col.goInfo.unresolvedType(); len(t) > 0 {
+			problems = append(problems, fmt.Sprintf("Column %s of %s has unknown type %s",
+				col.ColumnName, owner, t))
+		}
 	}
+	for tableName, tableMap := range selected {
+		for i := range tableMap.colDesc {
+			check(&tableMap.colDesc[i], "table "+tableName)
+		}
+	}
+	for _, q := range v.Queries {
+		if qm, ok := meta.Queries[q.Name]; ok {
+			for i := range qm.Columns {
+				check(&qm.Columns[i], "query "+q.Name)
+			}
+		}
+	}
+	for name, c := range used.Composites {
+		for i := range c.Attributes {
+			check(&c.Attributes[i], "composite type "+name)
+		}
+	}
+	sort.Strings(problems)
+	for _, p := range problems {
+		if v.StrictTypes {
+			fmt.Println("***ERROR***", p)
+		} else {
+			fmt.Println("***WARNING***", p+", it is held as text using "+meta.textRecType())
+		}
+	}
+	sort.Strings(unsupported)
+	for _, p := range unsupported {
+		fmt.Println("***ERROR***", p)
+	}
+	return (!v.StrictTypes || len(problems) == 0) && len(unsupported) == 0
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  pgx-daogen --init                           create empty config file
+  pgx-daogen --version                        print the version
+  pgx-daogen [generate]                       generate code from the database
+  pgx-daogen generate --from-snapshot FILE    generate code from a snapshot file
+  pgx-daogen check [--from-snapshot FILE]     check that the generated code is up to date
+  pgx-daogen inspect [-o FILE]                write a snapshot of the database (default %s)
+`, defaultSnapshotFile)
 }
 
 func main() {
 	initPtr := flag.Bool("init", false, "Create empty config file")
+	versionPtr := flag.Bool("version", false, "Print the version")
+	flag.Usage = usage
 	flag.Parse()
+	if *versionPtr {
+		fmt.Println("pgx-daogen", daogenVersion)
+		os.Exit(0)
+	}
 	if *initPtr {
 		genConfigFile()
 		os.Exit(0)
 	}
 
-	if _, err := os.Stat(configFileName); !os.IsNotExist(err) {
-		processGodaoFile()
-	} else {
+	if _, err := os.Stat(configFileName); os.IsNotExist(err) {
 		fmt.Println("Error opening config file. Use --init option to create empty file")
 		os.Exit(1)
 	}
+
+	command := "generate"
+	args := flag.Args()
+	if len(args) > 0 {
+		command = args[0]
+		args = args[1:]
+	}
+	switch command {
+	case "generate":
+		fs := flag.NewFlagSet("generate", flag.ExitOnError)
+		snapshotPtr := fs.String("from-snapshot", "", "Generate from the given snapshot file instead of the database")
+		fs.Parse(args)
+		processGodaoFile(*snapshotPtr)
+	case "check":
+		fs := flag.NewFlagSet("check", flag.ExitOnError)
+		snapshotPtr := fs.String("from-snapshot", "", "Check against a snapshot file instead of the database")
+		fs.Parse(args)
+		checkGodaoFile(*snapshotPtr)
+	case "inspect":
+		fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+		outPtr := fs.String("o", defaultSnapshotFile, "Snapshot file to be written")
+		fs.Parse(args)
+		inspectDatabase(*outPtr)
+	default:
+		fmt.Println("Unknown command", command)
+		usage()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nullModes - the accepted NullMode values of the config. Without a mode
+// NULL is held in the VO as the null value of the type. pointer, sql and
+// optional make the VO fields of nullable columns *T, sql.Null* and the
+// generated Optional[T]
+var nullModes = map[string]bool{"": true, "sentinel": true, "pointer": true, "sql": true, "optional": true}
+
+// sqlNullType - a database/sql type for nullable values and its value field
+type sqlNullType struct {
+	name  string
+	field string
+}
+
+var sqlNullTypes = map[string]sqlNullType{
+	"string":    {"sql.NullString", "String"},
+	"bool":      {"sql.NullBool", "Bool"},
+	"int16":     {"sql.NullInt16", "Int16"},
+	"int32":     {"sql.NullInt32", "Int32"},
+	"int64":     {"sql.NullInt64", "Int64"},
+	"float64":   {"sql.NullFloat64", "Float64"},
+	"time.Time": {"sql.NullTime", "Time"},
+}
+
+// nullableColInfo - go type information of a table or query column, with
+// the VO type able to hold NULL as configured by NullMode if the column is
+// nullable. Pointer and slice VO types use nil for NULL in every mode
+func (meta *DBMeta) nullableColInfo(col *ColDesc) GoColInfo {
+	info := col.goInfo
+	info.nullable = col.IsNullable && (info.domain == nil || !info.domain.NotNull)
+	if meta.nullMode == "" || meta.nullMode == "sentinel" || !info.nullable {
+		return info
+	}
+	inner := info
+	// NULL is an unset VO field, so a set zero value is written as it is
+	inner.nullable = false
+	info.inner = &inner
+	info.nullMode = meta.nullMode
+	info.nullValue = "nil"
+	switch {
+	case strings.HasPrefix(inner.voType, "*") || strings.HasPrefix(inner.voType, "[]"):
+		info.nullMode = "nil"
+	case meta.nullMode == "pointer":
+		info.voType = "*" + inner.voType
+	case meta.nullMode == "sql":
+		info.voType = "sql.Null[" + inner.voType + "]"
+		if st, ok := sqlNullTypes[inner.voType]; ok {
+			info.voType = st.name
+		}
+	case meta.nullMode == "optional":
+		info.voType = "Optional[" + inner.voType + "]"
+	}
+	return info
+}
+
+// nullField - name of the value field of the sql.Null* or Optional VO type
+func (g *GoColInfo) nullField() string {
+	if st, ok := sqlNullTypes[g.inner.voType]; ok && g.nullMode == "sql" {
+		return st.field
+	}
+	return "V"
+}
+
+// nullableVO - go expression for the VO value of a NULL, for a nullable VO
+// type
+func (g *GoColInfo) nullableVO() string {
+	if g.nullMode == "sql" || g.nullMode == "optional" {
+		return g.voType + "{}"
+	}
+	return "nil"
+}
+
+// nullableFromRecord - go expression converting the pgtype value rec, which
+// is not NULL, to a nullable VO type
+func (g *GoColInfo) nullableFromRecord(rec string) string {
+	return g.nullableFromValue(g.inner.fromRecord(rec))
+}
+
+// nullableFromValue - go expression wrapping the plain VO value v into the
+// nullable VO type
+func (g *GoColInfo) nullableFromValue(v string) string {
+	switch g.nullMode {
+	case "pointer":
+		return "daogenPtr(" + v + ")"
+	case "sql", "optional":
+		return fmt.Sprintf("%s{%s: %s, Valid: true}", g.voType, g.nullField(), v)
+	}
+	return v
+}
+
+// nullableToRecord - statement setting the pgtype value rec from a nullable
+// VO value, writing NULL if it is unset
+func (g *GoColInfo) nullableToRecord(rec string, value string, fail string) string {
+	switch g.nullMode {
+	case "pointer":
+		return fmt.Sprintf("if %s == nil { %s } else { %s }",
+			value, g.setNull(rec), g.inner.toRecord(rec, "*"+value, fail))
+	case "sql", "optional":
+		return fmt.Sprintf("if !%s.Valid { %s } else { %s }",
+			value, g.setNull(rec), g.inner.toRecord(rec, value+"."+g.nullField(), fail))
+	}
+	return fmt.Sprintf("if %s == nil { %s } else { %s }",
+		value, g.setNull(rec), g.inner.toRecord(rec, value, fail))
+}
+
+// plainVOType - the VO type without the wrapping for NULL, as used for key
+// parameters
+func (g *GoColInfo) plainVOType() string {
+	if g.inner != nil {
+		return g.inner.voType
+	}
+	return g.voType
+}
+
+// genNullHelpers - the helpers used by the nullable VO types of the given
+// NullMode
+func genNullHelpers(nullMode string) {
+	switch nullMode {
+	case "pointer":
+		ff(`// daogenPtr - pointer to a copy of v, for the VO fields of nullable columns
+func daogenPtr[T any](v T) *T {
+	return &v
+}
+
+`)
+	case "optional":
+		ff(`// Optional - VO type of nullable columns. Valid is false for NULL
+type Optional[T any] struct {
+	V     T
+	Valid bool
+}
+
+// OptionalOf - an Optional holding v
+func OptionalOf[T any](v T) Optional[T] {
+	return Optional[T]{V: v, Valid: true}
+}
+
+// Get - the value and whether it is set
+func (o Optional[T]) Get() (T, bool) {
+	return o.V, o.Valid
+}
+
+// Value - implements driver.Valuer, so that an Optional can be used as a
+// query parameter. V is converted as database/sql converts parameters, so
+// that the result is one of the driver.Value types
+func (o Optional[T]) Value() (driver.Value, error) {
+	if !o.Valid {
+		return nil, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(o.V)
+}
+
+`)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkTypeOverrides - reports the column overrides matching no column
+func (meta *DBMeta) checkTypeOverrides() {
+	for i := range meta.overrides.Columns {
+		o := &meta.overrides.Columns[i]
+		found := false
+		for _, mp := range meta.Tables {
+			for j := range mp.colDesc {
+				if o.matchesColumn(&mp.colDesc[j]) {
+					found = true
+				}
+			}
+		}
+		for _, c := range meta.Composites {
+			for j := range c.Attributes {
+				if o.matchesColumn(&c.Attributes[j]) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			fmt.Println("***WARNING***", "Type override for column", o.Column, "matches no column")
+		}
+	}
+}
+
+// overrideFor - the type override for the column, nil if there is none.
+// Type overrides do not apply to arrays as a whole, but to their elements
+func (meta *DBMeta) overrideFor(col *ColDesc) *TypeOverride {
+	if meta.overrides == nil {
+		return nil
+	}
+	for i := range meta.overrides.Columns {
+		if meta.overrides.Columns[i].matchesColumn(col) {
+			return &meta.overrides.Columns[i]
+		}
+	}
+	if col.isArray() {
+		return nil
+	}
+	for i := range meta.overrides.Types {
+		if meta.overrides.Types[i].matchesType(col) {
+			return &meta.overrides.Types[i]
+		}
+	}
+	return nil
+}
+
+// matchesColumn - true if the override is for the column, given as
+// table.column or schema.table.column. Composite attributes are given as
+// type.attribute
+func (o *TypeOverride) matchesColumn(col *ColDesc) bool {
+	if len(o.Column) == 0 || len(col.TableName) == 0 {
+		return false
+	}
+	name := col.TableName + "." + col.ColumnName
+	return o.Column == name || o.Column == col.TableSchema+"."+name
+}
+
+// matchesType - true if the override is for the type of the column. Built in
+// types are matched by any of their names, others by name or schema
+// qualified name
+func (o *TypeOverride) matchesType(col *ColDesc) bool {
+	if len(o.Type) == 0 {
+		return false
+	}
+	if bt := lookupBuiltinType(o.Type); bt != nil {
+		return lookupColType(col) == bt
+	}
+	return o.Type == col.TypeName || o.Type == col.TypeSchema+"."+col.TypeName
+}
+
+// apply - go type information for a column of the base type with the VO
+// type replaced. The Rec type is kept, the conversion goes through its text
+// form
+func (o *TypeOverride) apply(base GoColInfo) GoColInfo {
+	info := base
+	info.voType = o.GoType
+	info.nullValue = o.NullValue
+	if len(info.nullValue) == 0 {
+		if strings.HasPrefix(o.GoType, "*") {
+			info.nullValue = "nil"
+		} else {
+			info.nullValue = "*new(" + o.GoType + ")"
+		}
+	}
+	info.pgValueField = ""
+	info.pgTypeCast = ""
+	info.enum = nil
+	info.textCoded = false
+	info.unknownType = ""
+	info.pgOID = ""
+	info.override = o
+	return info
+}
+
+// overrideFunc - name of the generated function converting from the Rec to
+// the overridden VO type (dir From) or back (dir To)
+func (g *GoColInfo) overrideFunc(dir string) string {
+	format := "Text"
+	if g.isJSON {
+		format = "JSON"
+	}
+	return "daogen" + goTypeSuffix(g.voType) + dir + format
+}
+
+// addImports - adds the import paths needed by the VO type to imports
+func (g *GoColInfo) addImports(imports map[string]bool) {
+	if g.nullMode == "sql" {
+		imports[`"database/sql"`] = true
+	}
+	if g.inner != nil {
+		g.inner.addImports(imports)
+		return
+	}
+	if g.override != nil && len(g.override.Import) > 0 {
+		imports[`"`+g.override.Import+`"`] = true
+	}
+	if g.array != nil {
+		g.array.elem.addImports(imports)
+	}
+}
+
+// overrideImports - import lines for the VO types of the columns
+func overrideImports(cols []ColDesc) string {
+	imports := map[string]bool{}
+	for i := range cols {
+		cols[i].goInfo.addImports(imports)
+	}
+	names := []string{}
+	for name := range imports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := ""
+	for _, name := range names {
+		lines += "\t" + name + "\n"
+	}
+	return lines
+}
+
+// genOverrideFuncs - the functions converting between the Rec and an
+// overridden VO type. json and jsonb values are converted with encoding/json,
+// all others by the MarshalText and UnmarshalText methods of the VO type
+func genOverrideFuncs(info GoColInfo) {
+	decl := "var v " + info.voType
+	unmarshal := "json.Unmarshal(buf, &v)"
+	marshal := "json.Marshal(v)"
+	if !info.isJSON {
+		if strings.HasPrefix(info.voType, "*") {
+			decl = "v := new(" + strings.TrimPrefix(info.voType, "*") + ")"
+		}
+		unmarshal = "v.UnmarshalText(buf)"
+		marshal = "v.MarshalText()"
+	}
+	if len(info.target) > 0 {
+		genTextOverrideFuncs(info, decl, unmarshal, marshal)
+		return
+	}
+	ff(`// %s - %s from the text form of a pgtype value.
+// Fails if the value can not be read
+func %s(src pgtype.TextEncoder) (%s, error) {
+	%s
+	buf, err := src.EncodeText(nil, nil)
+	if err != nil || buf == nil {
+		return v, err
+	}
+	err = %s
+	return v, err
+}
+
+// %s - sets the pgtype value dst from the text form of v
+func %s(v %s, dst pgtype.TextDecoder) error {
+	buf, err := %s
+	if err != nil {
+		return err
+	}
+	return dst.DecodeText(nil, buf)
+}
+
+`, info.overrideFunc("From"), info.voType, info.overrideFunc("From"), info.voType, decl, unmarshal,
+		info.overrideFunc("To"), info.overrideFunc("To"), info.voType, marshal)
+}
+
+// genTextOverrideFuncs - the functions converting between the text Rec of
+// pgx v5 or database/sql, pgtype.Text or sql.NullString, and an overridden VO
+// type
+func genTextOverrideFuncs(info GoColInfo, decl string, unmarshal string, marshal string) {
+	ff(`// %s - %s from its text form. Fails if the value can not
+// be read
+func %s(src string) (%s, error) {
+	%s
+	buf := []byte(src)
+	err := %s
+	return v, err
+}
+
+// %s - sets the %s dst to the text form of v
+func %s(v %s, dst *%s) error {
+	buf, err := %s
+	if err != nil {
+		return err
+	}
+	*dst = %s{String: string(buf), Valid: true}
+	return nil
+}
+
+`, info.overrideFunc("From"), info.voType, info.overrideFunc("From"), info.voType, decl, unmarshal,
+		info.overrideFunc("To"), info.recType, info.overrideFunc("To"), info.voType, info.recType, marshal,
+		info.recType)
+}
@@ -12,6 +12,15 @@ type DBase struct {
 	ConnPool *pgx.ConnPool
 }
 
+// Querier - what the generated table and query objects need of the
+// connection pool, satisfied by *pgx.ConnPool and *pgx.Tx
+type Querier interface {
+	Prepare(name, sql string) (*pgx.PreparedStatement, error)
+	Query(sql string, args ...interface{}) (*pgx.Rows, error)
+	QueryRow(sql string, args ...interface{}) *pgx.Row
+	Exec(sql string, arguments ...interface{}) (pgx.CommandTag, error)
+}
+
 // CreateConnection - create connection pool
 func CreateConnection(hostname string, dbname string, userName string,
 	password string, numConnections int) (*DBase, error) {
@@ -41,3 +50,23 @@ func CreateConnection(hostname string, dbname string, userName string,
 func (dbconn *DBase) Close() {
 	dbconn.ConnPool.Close()
 }
+
+// InTx - runs fn in a transaction, which is committed if fn returns nil and
+// rolled back if fn returns an error or panics. The panic is passed on
+func (dbconn *DBase) InTx(fn func(tx *pgx.Tx) error) error {
+	tx, err := dbconn.ConnPool.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
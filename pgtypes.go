@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+)
+
+// pgBuiltinType - a built in postgres type. dataType is the name used by
+// information_schema.columns.data_type, typName the pg_type.typname
+type pgBuiltinType struct {
+	dataType string
+	typName  string
+	oid      uint32
+	arrayOID uint32
+}
+
+var pgBuiltinTypes = []pgBuiltinType{
+	{"boolean", "bool", 16, 1000},
+	{"bytea", "bytea", 17, 1001},
+	{"\"char\"", "char", 18, 1002},
+	{"name", "name", 19, 1003},
+	{"bigint", "int8", 20, 1016},
+	{"smallint", "int2", 21, 1005},
+	{"integer", "int4", 23, 1007},
+	{"text", "text", 25, 1009},
+	{"oid", "oid", 26, 1028},
+	{"json", "json", 114, 199},
+	{"xml", "xml", 142, 143},
+	{"point", "point", 600, 1017},
+	{"lseg", "lseg", 601, 1018},
+	{"path", "path", 602, 1019},
+	{"box", "box", 603, 1020},
+	{"polygon", "polygon", 604, 1027},
+	{"line", "line", 628, 629},
+	{"cidr", "cidr", 650, 651},
+	{"real", "float4", 700, 1021},
+	{"double precision", "float8", 701, 1022},
+	{"circle", "circle", 718, 719},
+	{"macaddr8", "macaddr8", 774, 775},
+	{"money", "money", 790, 791},
+	{"macaddr", "macaddr", 829, 1040},
+	{"inet", "inet", 869, 1041},
+	{"character", "bpchar", 1042, 1014},
+	{"character varying", "varchar", 1043, 1015},
+	{"date", "date", 1082, 1182},
+	{"time without time zone", "time", 1083, 1183},
+	{"timestamp without time zone", "timestamp", 1114, 1115},
+	{"timestamp with time zone", "timestamptz", 1184, 1185},
+	{"interval", "interval", 1186, 1187},
+	{"time with time zone", "timetz", 1266, 1270},
+	{"bit", "bit", 1560, 1561},
+	{"bit varying", "varbit", 1562, 1563},
+	{"numeric", "numeric", 1700, 1231},
+	{"uuid", "uuid", 2950, 2951},
+	{"tsvector", "tsvector", 3614, 3643},
+	{"tsquery", "tsquery", 3615, 3645},
+	{"jsonb", "jsonb", 3802, 3807},
+	{"int4range", "int4range", 3904, 3905},
+	{"numrange", "numrange", 3906, 3907},
+	{"tsrange", "tsrange", 3908, 3909},
+	{"tstzrange", "tstzrange", 3910, 3911},
+	{"daterange", "daterange", 3912, 3913},
+	{"int8range", "int8range", 3926, 3927},
+}
+
+// pgTypeAliases - alternative spellings accepted in DDL, mapped to typname
+var pgTypeAliases = map[string]string{
+	"int":                         "int4",
+	"integer":                     "int4",
+	"smallint":                    "int2",
+	"bigint":                      "int8",
+	"serial":                      "int4",
+	"serial4":                     "int4",
+	"smallserial":                 "int2",
+	"serial2":                     "int2",
+	"bigserial":                   "int8",
+	"serial8":                     "int8",
+	"real":                        "float4",
+	"float":                       "float8",
+	"double precision":            "float8",
+	"decimal":                     "numeric",
+	"boolean":                     "bool",
+	"character varying":           "varchar",
+	"char varying":                "varchar",
+	"character":                   "bpchar",
+	"char":                        "bpchar",
+	"timestamp without time zone": "timestamp",
+	"timestamp with time zone":    "timestamptz",
+	"time without time zone":      "time",
+	"time with time zone":         "timetz",
+	"bit varying":                 "varbit",
+}
+
+// lookupBuiltinType - finds a built in type by its typname or one of its
+// aliases
+func lookupBuiltinType(name string) *pgBuiltinType {
+	name = strings.ToLower(name)
+	if alias, ok := pgTypeAliases[name]; ok {
+		name = alias
+	}
+	return lookupBuiltinTypeName(name)
+}
+
+// lookupBuiltinTypeName - finds a built in type by its exact typname
+func lookupBuiltinTypeName(name string) *pgBuiltinType {
+	for i := range pgBuiltinTypes {
+		if pgBuiltinTypes[i].typName == name {
+			return &pgBuiltinTypes[i]
+		}
+	}
+	return nil
+}
+
+// lookupBuiltinOID - finds a built in type by its oid
+func lookupBuiltinOID(oid uint32) *pgBuiltinType {
+	for i := range pgBuiltinTypes {
+		if pgBuiltinTypes[i].oid == oid {
+			return &pgBuiltinTypes[i]
+		}
+	}
+	return nil
+}
+
+// lookupBuiltinArrayOID - finds a built in type by the oid of its array type
+func lookupBuiltinArrayOID(oid uint32) *pgBuiltinType {
+	for i := range pgBuiltinTypes {
+		if pgBuiltinTypes[i].arrayOID == oid {
+			return &pgBuiltinTypes[i]
+		}
+	}
+	return nil
+}
+
+// lookupBuiltinDataType - finds a built in type by its information_schema
+// data type
+func lookupBuiltinDataType(dataType string) *pgBuiltinType {
+	for i := range pgBuiltinTypes {
+		if pgBuiltinTypes[i].dataType == dataType {
+			return &pgBuiltinTypes[i]
+		}
+	}
+	return nil
+}
+
+// lookupColType - finds the built in type of a column, by exact match only.
+// A known oid decides on its own. Without an oid the pg_type name is used for
+// pg_catalog types, then the information_schema data type. nil means the
+// column is not of a built in type
+func lookupColType(col *ColDesc) *pgBuiltinType {
+	if col.TypeOID != 0 {
+		return lookupBuiltinOID(col.TypeOID)
+	}
+	if col.TypeSchema == "pg_catalog" || col.TypeSchema == "" {
+		if bt := lookupBuiltinTypeName(col.TypeName); bt != nil {
+			return bt
+		}
+	}
+	return lookupBuiltinDataType(col.DataType)
+}
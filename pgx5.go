@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pgxVersions - the accepted PgxVersion values of the config. The generated
+// code uses github.com/jackc/pgx (v3) by default. With 5 it uses pgx v5, with
+// a pgxpool.Pool and a context.Context for every call reaching the database
+var pgxVersions = map[int]bool{0: true, 3: true, 5: true}
+
+// pgx5Type - the pgx v5 Rec type standing in for a pgx v3 Rec type. field
+// and cast are used like pgValueField and pgTypeCast. Types with an oid are
+// converted through their text form by a pgtype.Map, like the textCoded
+// types of pgx v3
+type pgx5Type struct {
+	recType string
+	field   string
+	cast    string
+	oid     string
+}
+
+// pgx5Types - the pgx v5 Rec types by pgx v3 Rec type. All other types are
+// held in pgtype.Text, which pgx v5 reads and writes through the text form of
+// any type
+var pgx5Types = map[string]pgx5Type{
+	"pgtype.Bool":        {"pgtype.Bool", "Bool", "bool(", ""},
+	"pgtype.Int2":        {"pgtype.Int2", "Int16", "int16(", ""},
+	"pgtype.Int4":        {"pgtype.Int4", "Int32", "int32(", ""},
+	"pgtype.Int8":        {"pgtype.Int8", "Int64", "int64(", ""},
+	"pgtype.OIDValue":    {"pgtype.Uint32", "Uint32", "uint32(", ""},
+	"pgtype.Float4":      {"pgtype.Float4", "Float32", "float32(", ""},
+	"pgtype.Float8":      {"pgtype.Float8", "Float64", "float64(", ""},
+	"pgtype.Bytea":       {"sql.Null[[]byte]", "V", "[]byte(", ""},
+	"pgtype.Date":        {"pgtype.Date", "Time", "", ""},
+	"pgtype.Timestamp":   {"pgtype.Timestamp", "Time", "", ""},
+	"pgtype.Timestamptz": {"pgtype.Timestamptz", "Time", "", ""},
+	"pgtype.Int4range":   {"pgtype.Range[pgtype.Int4]", "", "", "pgtype.Int4rangeOID"},
+	"pgtype.Int8range":   {"pgtype.Range[pgtype.Int8]", "", "", "pgtype.Int8rangeOID"},
+	"pgtype.Numrange":    {"pgtype.Range[pgtype.Numeric]", "", "", "pgtype.NumrangeOID"},
+	"pgtype.Daterange":   {"pgtype.Range[pgtype.Date]", "", "", "pgtype.DaterangeOID"},
+	"pgtype.Tsrange":     {"pgtype.Range[pgtype.Timestamp]", "", "", "pgtype.TsrangeOID"},
+	"pgtype.Tstzrange":   {"pgtype.Range[pgtype.Timestamptz]", "", "", "pgtype.TstzrangeOID"},
+}
+
+// pgx5ColInfo - go type information of a built in type for pgx v5. The VO
+// type stays the same, so that the VOs do not depend on the pgx version
+func pgx5ColInfo(info GoColInfo) GoColInfo {
+	t, ok := pgx5Types[info.recType]
+	if !ok {
+		t = pgx5Type{"pgtype.Text", "String", "string(", ""}
+	}
+	info.recType = t.recType
+	info.pgOID = t.oid
+	if !info.textCoded || len(t.oid) == 0 {
+		info.pgValueField = t.field
+		info.pgTypeCast = t.cast
+	}
+	// pgx v5 reads multiranges in binary format, which has no text form
+	if strings.HasSuffix(info.unknownType, "multirange") {
+		info.unsupported = "the multirange type " + info.unknownType
+	}
+	return info
+}
+
+// unsupportedType - what the pgx version of the generated code can not
+// handle in the column type, directly or as array element, or ""
+func (g *GoColInfo) unsupportedType() string {
+	if g.inner != nil {
+		return g.inner.unsupportedType()
+	}
+	if g.array != nil && len(g.unsupported) == 0 {
+		return g.array.elem.unsupportedType()
+	}
+	return g.unsupported
+}
+
+// pgx5FromText - go expression converting the pgx v5 or database/sql value
+// rec of a type held in its text form to the VO type. The expression gives an
+// error as well for the types converted by a pgtype.Map
+func (g *GoColInfo) pgx5FromText(rec string) string {
+	if len(g.pgOID) > 0 {
+		return fmt.Sprintf("daogenEncodeText(%s, %s)", g.pgOID, rec)
+	}
+	return fmt.Sprintf("%s(%s.String)", g.voType, rec)
+}
+
+// pgx5ToText - statement setting the pgx v5 or database/sql value rec of a
+// type held in its text form from the VO value. An empty VO value is written
+// as NULL to nullable columns. For the types converted by a pgtype.Map a
+// value that can not be read runs fail
+func (g *GoColInfo) pgx5ToText(rec string, value string, fail string) string {
+	set := fmt.Sprintf("%s.String = string(%s)", rec, value)
+	if len(g.pgOID) > 0 {
+		set = fmt.Sprintf("if err := daogenDecodeText(%s, string(%s), &%s); err != nil { %s }",
+			g.pgOID, value, rec, fail)
+	}
+	if !g.nullable {
+		return set
+	}
+	return fmt.Sprintf(`if %s == "" { %s } else { %s }`, value, g.setNull(rec), set)
+}
+
+// genPgx5TextHelpers - the conversion of pgx v5 values to and from their
+// text form, used by the types held in their text form and by composite types
+func genPgx5TextHelpers() {
+	ff(`// daogenTypeMap - converts values to and from their postgres text form
+var daogenTypeMap = pgtype.NewMap()
+
+// daogenEncodeText - text form of the value v of the type oid, "" for NULL
+func daogenEncodeText(oid uint32, v interface{}) (string, error) {
+	buf, err := daogenTypeMap.Encode(oid, pgtype.TextFormatCode, v, nil)
+	return string(buf), err
+}
+
+// daogenDecodeText - sets dst, a pointer to a value of the type oid, from
+// the text form src
+func daogenDecodeText(oid uint32, src string, dst interface{}) error {
+	return daogenTypeMap.Scan(oid, pgtype.TextFormatCode, []byte(src), dst)
+}
+
+`)
+}
+
+// pgx5TypeOID - oid of the column type, given to the pgtype.Map of pgx v5 to
+// convert a value of the column, or 0 if not known. The Map reads and writes
+// the values of an unknown type in their text form
+func pgx5TypeOID(col *ColDesc) uint32 {
+	if col.TypeOID != 0 {
+		return col.TypeOID
+	}
+	if col.isArray() {
+		elem := col.elemColDesc()
+		if bt := lookupColType(&elem); bt != nil {
+			return bt.arrayOID
+		}
+		return 0
+	}
+	if bt := lookupColType(col); bt != nil {
+		return bt.oid
+	}
+	return 0
+}
+
+// genPgx5Composite - the go struct of a composite type and its Rec for pgx
+// v5. The Rec implements sql.Scanner and driver.Valuer on the text form of the
+// composite value, converting the fields by daogenTypeMap
+func genPgx5Composite(c *CompositeDesc) {
+	goName := c.GoName()
+
+	//=========   Generate the struct and its Rec ===========
+	{
+		genCompositeStruct(c)
+		ff(`// %sRec - holder of %s, used in the Rec structs
+type %sRec struct {
+	V     %s
+	Valid bool
+}
+
+`, goName, goName, goName, goName)
+	}
+	//-------------------------------------
+
+	//=========   Generate Scan ===========
+	{
+		ff(`// Scan - implements sql.Scanner
+func (r *%sRec) Scan(src interface{}) error {
+	var text []byte
+	switch src := src.(type) {
+	case nil:
+		*r = %sRec{}
+		return nil
+	case string:
+		text = []byte(src)
+	case []byte:
+		text = src
+	default:
+		return fmt.Errorf("%s: can not scan %%T", src)
+	}
+	fields, err := daogenParseRecord(text)
+	if err != nil {
+		return err
+	}
+	if len(fields) != %d {
+		return fmt.Errorf("%s: expected %d fields, got %%d", len(fields))
+	}
+	r.V = %s{}
+`, goName, goName, goName, len(c.Attributes), goName, len(c.Attributes), goName)
+		for i := range c.Attributes {
+			attr := &c.Attributes[i]
+			info := attr.goInfo
+			ff("\t{\n")
+			ff("\t\tvar f %s\n", info.recType)
+			ff("\t\tif err := daogenTypeMap.Scan(%d, pgtype.TextFormatCode, fields[%d], &f); err != nil {\n",
+				pgx5TypeOID(attr), i)
+			ff("\t\t\treturn err\n\t\t}\n")
+			ff("\t\tif %s {\n", info.isPresent("f"))
+			ff("\t\t\t%s\n", info.readVO("f", "r.V."+info.goColName, "return err"))
+			ff("\t\t} else {\n")
+			ff("\t\t\tr.V.%s = %s\n", info.goColName, info.nullVO())
+			ff("\t\t}\n\t}\n")
+		}
+		ff("\tr.Valid = true\n\treturn nil\n}\n\n")
+	}
+	//-------------------------------------
+
+	//=========   Generate Value ===========
+	{
+		ff(`// Value - implements driver.Valuer
+func (r %sRec) Value() (driver.Value, error) {
+	if !r.Valid {
+		return nil, nil
+	}
+	var err error
+	fields := make([][]byte, %d)
+`, goName, len(c.Attributes))
+		for i := range c.Attributes {
+			attr := &c.Attributes[i]
+			info := attr.goInfo
+			ff("\t{\n")
+			ff("\t\tvar f %s\n", info.recType)
+			ff("\t\t%s\n", info.setPresent("f"))
+			ff("\t\t%s\n", info.toRecord("f", "r.V."+info.goColName, "return nil, err"))
+			ff("\t\tif fields[%d], err = daogenTypeMap.Encode(%d, pgtype.TextFormatCode, f, []byte{}); err != nil {\n",
+				i, pgx5TypeOID(attr))
+			ff("\t\t\treturn nil, err\n\t\t}\n\t}\n")
+		}
+		ff("\treturn string(daogenFormatRecord(nil, fields)), nil\n}\n\n")
+	}
+	//-------------------------------------
+}
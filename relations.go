@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Relation - a foreign key between two tables that are both generated.
+// fromCols and toCols are the column indexes in the referencing and the
+// referenced table
+type Relation struct {
+	Constraint ConstraintDesc
+	From       *TableMap
+	To         *TableMap
+	fromCols   []int
+	toCols     []int
+	ambiguous  bool
+}
+
+// pluralize - naive english plural, used for the names of methods returning
+// many rows. Names already ending in s are taken to be plural
+func pluralize(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "s"):
+		return name
+	case strings.HasSuffix(lower, "x") || strings.HasSuffix(lower, "z") ||
+		strings.HasSuffix(lower, "ch") || strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 &&
+		!strings.ContainsAny(lower[len(lower)-2:len(lower)-1], "aeiou"):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+// viaSuffix - distinguishes relations when a table refers to another table
+// (or to itself) more than once
+func (r *Relation) viaSuffix() string {
+	if !r.ambiguous {
+		return ""
+	}
+	return "Via" + convertCase(strings.Join(r.Constraint.Columns, "_"))
+}
+
+// FetchMethod - name of the method on the referencing table
+func (r *Relation) FetchMethod() string {
+	return "Fetch" + r.To.GoName() + r.viaSuffix()
+}
+
+// SelectMethod - name of the method on the referenced table
+func (r *Relation) SelectMethod() string {
+	return "Select" + pluralize(r.From.GoName()) + r.viaSuffix()
+}
+
+// whereCond - condition on the columns of one side of the relation
+func whereCond(tableMap *TableMap, cols []int) string {
+	cond := ""
+	for i, subs := range cols {
+		if i > 0 {
+			cond += " AND "
+		}
+		cond += fmt.Sprintf("%s = $%d", quoteIdent(tableMap.colDesc[subs].ColumnName), i+1)
+	}
+	return cond
+}
+
+// linkRelations - finds the foreign keys between the given tables and
+// records them on both sides. Foreign keys to tables that are not generated
+// are ignored
+func linkRelations(tables map[string]*TableMap) {
+	for _, mp := range tables {
+		mp.references = nil
+		mp.referencedBy = nil
+	}
+	for _, from := range tables {
+		for _, con := range from.Constraints {
+			if con.Type != "FOREIGN KEY" {
+				continue
+			}
+			to, ok := tables[con.RefSchema+"."+con.RefTable]
+			if !ok || len(con.Columns) != len(con.RefColumns) {
+				continue
+			}
+			r := Relation{Constraint: con, From: from, To: to}
+			for i := range con.Columns {
+				r.fromCols = append(r.fromCols, from.colIndex(con.Columns[i]))
+				r.toCols = append(r.toCols, to.colIndex(con.RefColumns[i]))
+			}
+			from.references = append(from.references, &r)
+		}
+	}
+	for _, from := range tables {
+		for _, r := range from.references {
+			count := 0
+			for _, other := range from.references {
+				if other.To == r.To {
+					count++
+				}
+			}
+			r.ambiguous = count > 1 || r.From == r.To
+			r.To.referencedBy = append(r.To.referencedBy, r)
+		}
+	}
+	for _, mp := range tables {
+		sort.Slice(mp.referencedBy, func(i, j int) bool {
+			a, b := mp.referencedBy[i], mp.referencedBy[j]
+			if a.From != b.From {
+				return a.From.QualifiedName() < b.From.QualifiedName()
+			}
+			return a.Constraint.Name < b.Constraint.Name
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// snapshotVersion - to be incremented whenever the snapshot layout changes
+const snapshotVersion = 3
+
+var defaultSnapshotFile = "godao.snapshot.json"
+
+// DBMeta - everything the generator reads from the database. Can be loaded
+// either from a live database or from a snapshot file
+type DBMeta struct {
+	Tables     map[string]*TableMap
+	Queries    map[string]QueryMeta
+	Enums      map[string]*EnumDesc
+	Composites map[string]*CompositeDesc
+	Domains    map[string]*DomainDesc
+	overrides  *TypeOverrides
+	timeMode   string
+	timeZone   string
+	nullMode   string
+	tags       *Tags
+	pgxVersion int
+	backend    string
+}
+
+// QueryMeta - column descriptions of a query as returned by the server
+type QueryMeta struct {
+	Query   string
+	Columns []ColDesc
+}
+
+// Snapshot - versioned, serializable form of DBMeta
+type Snapshot struct {
+	Version    int
+	Tables     []SnapshotTable
+	Queries    []SnapshotQuery
+	Enums      []EnumDesc
+	Composites []CompositeDesc
+	Domains    []DomainDesc
+}
+
+type SnapshotTable struct {
+	TableSchema    string
+	TableName      string
+	Kind           string
+	Columns        []ColDesc
+	Constraints    []ConstraintDesc
+	Indexes        []IndexDesc
+	Sequencename   string
+	Sequenceprefix string
+}
+
+type SnapshotQuery struct {
+	Name    string
+	Query   string
+	Columns []ColDesc
+}
+
+// LoadDBMeta - introspects the database for all configured schemas and queries
+func LoadDBMeta(dbase *DBase, v *Genstruct) *DBMeta {
+	t := ProcessColMetadata(dbase, v.Schemas)
+	if t == nil {
+		return nil
+	}
+	enums := ProcessEnumMetadata(dbase, v.Schemas)
+	if enums == nil {
+		return nil
+	}
+	composites := ProcessCompositeMetadata(dbase, v.Schemas)
+	if composites == nil {
+		return nil
+	}
+	domains := ProcessDomainMetadata(dbase, v.Schemas)
+	if domains == nil {
+		return nil
+	}
+	meta := DBMeta{Tables: t, Queries: map[string]QueryMeta{}, Enums: enums,
+		Composites: composites, Domains: domains}
+	for _, q := range v.Queries {
+		cols := getQueryObject(dbase, q)
+		if cols == nil {
+			continue
+		}
+		meta.Queries[q.Name] = QueryMeta{Query: q.Query, Columns: cols}
+	}
+	meta.prepare()
+	return &meta
+}
+
+// sortedTableNames - keys of the table map in a stable order
+func (meta *DBMeta) sortedTableNames() []string {
+	names := make([]string, 0, len(meta.Tables))
+	for name := range meta.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedEnums - all enums in a stable order
+func (meta *DBMeta) sortedEnums() []*EnumDesc {
+	names := make([]string, 0, len(meta.Enums))
+	for name := range meta.Enums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	enums := []*EnumDesc{}
+	for _, name := range names {
+		enums = append(enums, meta.Enums[name])
+	}
+	return enums
+}
+
+// sortedComposites - all composite types in a stable order
+func (meta *DBMeta) sortedComposites() []*CompositeDesc {
+	names := make([]string, 0, len(meta.Composites))
+	for name := range meta.Composites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	composites := []*CompositeDesc{}
+	for _, name := range names {
+		composites = append(composites, meta.Composites[name])
+	}
+	return composites
+}
+
+// sortedDomains - all domains in a stable order
+func (meta *DBMeta) sortedDomains() []*DomainDesc {
+	names := make([]string, 0, len(meta.Domains))
+	for name := range meta.Domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	domains := []*DomainDesc{}
+	for _, name := range names {
+		domains = append(domains, meta.Domains[name])
+	}
+	return domains
+}
+
+func (meta *DBMeta) toSnapshot() *Snapshot {
+	snap := Snapshot{Version: snapshotVersion}
+	snap.Tables = []SnapshotTable{}
+	snap.Queries = []SnapshotQuery{}
+	for _, name := range meta.sortedTableNames() {
+		mp := meta.Tables[name]
+		snap.Tables = append(snap.Tables, SnapshotTable{
+			TableSchema:    mp.TableSchema,
+			TableName:      mp.TableName,
+			Kind:           mp.Kind,
+			Columns:        mp.colDesc,
+			Constraints:    mp.Constraints,
+			Indexes:        mp.Indexes,
+			Sequencename:   mp.Sequencename,
+			Sequenceprefix: mp.Sequenceprefix,
+		})
+	}
+	queryNames := []string{}
+	for name := range meta.Queries {
+		queryNames = append(queryNames, name)
+	}
+	sort.Strings(queryNames)
+	for _, name := range queryNames {
+		q := meta.Queries[name]
+		snap.Queries = append(snap.Queries, SnapshotQuery{Name: name, Query: q.Query, Columns: q.Columns})
+	}
+	snap.Enums = []EnumDesc{}
+	for _, e := range meta.sortedEnums() {
+		snap.Enums = append(snap.Enums, *e)
+	}
+	snap.Composites = []CompositeDesc{}
+	for _, c := range meta.sortedComposites() {
+		snap.Composites = append(snap.Composites, *c)
+	}
+	snap.Domains = []DomainDesc{}
+	for _, d := range meta.sortedDomains() {
+		snap.Domains = append(snap.Domains, *d)
+	}
+	return &snap
+}
+
+func (snap *Snapshot) toDBMeta() *DBMeta {
+	meta := DBMeta{Tables: map[string]*TableMap{}, Queries: map[string]QueryMeta{},
+		Enums: map[string]*EnumDesc{}, Composites: map[string]*CompositeDesc{},
+		Domains: map[string]*DomainDesc{}}
+	for i := range snap.Enums {
+		meta.Enums[snap.Enums[i].QualifiedName()] = &snap.Enums[i]
+	}
+	for i := range snap.Composites {
+		meta.Composites[snap.Composites[i].QualifiedName()] = &snap.Composites[i]
+	}
+	for i := range snap.Domains {
+		meta.Domains[snap.Domains[i].QualifiedName()] = &snap.Domains[i]
+	}
+	for _, st := range snap.Tables {
+		mp := CreateNewTablemap(st.TableSchema, st.TableName)
+		mp.Kind = st.Kind
+		mp.Sequencename = st.Sequencename
+		mp.Sequenceprefix = st.Sequenceprefix
+		for _, col := range st.Columns {
+			// Key membership is derived again from the constraints
+			col.Keys = nil
+			mp.colDesc = append(mp.colDesc, col)
+		}
+		for _, con := range st.Constraints {
+			mp.addConstraint(con)
+		}
+		if st.Indexes != nil {
+			mp.Indexes = st.Indexes
+		}
+		meta.Tables[mp.QualifiedName()] = mp
+	}
+	for _, sq := range snap.Queries {
+		meta.Queries[sq.Name] = QueryMeta{Query: sq.Query, Columns: sq.Columns}
+	}
+	meta.prepare()
+	return &meta
+}
+
+// fingerprint - short hash of the metadata the code is generated from: the
+// given tables and queries, and all user defined types. OIDs are left out,
+// as they differ between databases holding the same schema
+func (meta *DBMeta) fingerprint(tables map[string]*TableMap, queries []QueryInfo) string {
+	sub := DBMeta{Tables: tables, Queries: map[string]QueryMeta{}, Enums: meta.Enums,
+		Composites: meta.Composites, Domains: meta.Domains}
+	for _, q := range queries {
+		if qm, ok := meta.Queries[q.Name]; ok {
+			sub.Queries[q.Name] = qm
+		}
+	}
+	bytes, _ := json.Marshal(sub.toSnapshot())
+	var generic interface{}
+	json.Unmarshal(bytes, &generic)
+	bytes, _ = json.Marshal(withoutOIDs(generic))
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:8])
+}
+
+// withoutOIDs - removes the OID fields from decoded JSON
+func withoutOIDs(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			if strings.HasSuffix(key, "OID") {
+				delete(t, key)
+			} else {
+				t[key] = withoutOIDs(value)
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = withoutOIDs(t[i])
+		}
+	}
+	return v
+}
+
+// WriteSnapshot - writes the metadata as an indented JSON snapshot
+func WriteSnapshot(meta *DBMeta, fileName string) error {
+	bytes, err := json.MarshalIndent(meta.toSnapshot(), "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append(bytes, '\n'), 0644)
+}
+
+// ReadSnapshot - reads a snapshot written by WriteSnapshot
+func ReadSnapshot(fileName string) (*DBMeta, error) {
+	bytes, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	snap := Snapshot{}
+	if err = json.Unmarshal(bytes, &snap); err != nil {
+		return nil, err
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot %s has version %d, expected %d", fileName,
+			snap.Version, snapshotVersion)
+	}
+	return snap.toDBMeta(), nil
+}
@@ -0,0 +1,428 @@
+package main
+
+// backends - the accepted Backend values of the config. pgx is the default,
+// database/sql generates the same table and query objects on *sql.DB and
+// *sql.Tx, with the sql.Null* types in the Recs instead of pgtype
+var backends = map[string]bool{"": true, "pgx": true, "database/sql": true}
+
+// target - the code the columns and templates are generated for: "" for
+// pgx v3, "pgx5" for pgx v5 and "sql" for database/sql
+func (meta *DBMeta) target() string {
+	if meta.backend == "database/sql" {
+		return "sql"
+	}
+	if meta.pgxVersion == 5 {
+		return "pgx5"
+	}
+	return ""
+}
+
+// targetName - the config setting of the target, as printed in errors
+func (meta *DBMeta) targetName() string {
+	switch meta.target() {
+	case "sql":
+		return "Backend database/sql"
+	case "pgx5":
+		return "PgxVersion 5"
+	}
+	return "PgxVersion 3"
+}
+
+// textRecType - the Rec type of columns held in their text form, and of
+// the types the generator has no mapping for
+func (meta *DBMeta) textRecType() string {
+	switch meta.target() {
+	case "sql":
+		return "sql.NullString"
+	case "pgx5":
+		return "pgtype.Text"
+	}
+	return "pgtype.GenericText"
+}
+
+// sqlTypes - the database/sql Rec types standing in for the pgx v3 Rec
+// types, with the value field and the cast of the VO value. All other types
+// are held in sql.NullString, as the drivers read and write them as text
+var sqlTypes = map[string]pgx5Type{
+	"pgtype.Bool":        {"sql.NullBool", "Bool", "bool(", ""},
+	"pgtype.Int2":        {"sql.NullInt16", "Int16", "int16(", ""},
+	"pgtype.Int4":        {"sql.NullInt32", "Int32", "int32(", ""},
+	"pgtype.Int8":        {"sql.NullInt64", "Int64", "int64(", ""},
+	"pgtype.OIDValue":    {"sql.NullInt64", "Int64", "int64(", ""},
+	"pgtype.Float4":      {"sql.NullFloat64", "Float64", "float64(", ""},
+	"pgtype.Float8":      {"sql.NullFloat64", "Float64", "float64(", ""},
+	"pgtype.Bytea":       {"sql.Null[[]byte]", "V", "[]byte(", ""},
+	"pgtype.Date":        {"sql.NullTime", "Time", "", ""},
+	"pgtype.Timestamp":   {"sql.NullTime", "Time", "", ""},
+	"pgtype.Timestamptz": {"sql.NullTime", "Time", "", ""},
+}
+
+// sqlColInfo - go type information of a built in type for database/sql.
+// The VO type stays the same as for pgx
+func sqlColInfo(info GoColInfo) GoColInfo {
+	t, ok := sqlTypes[info.recType]
+	if !ok {
+		t = pgx5Type{"sql.NullString", "String", "string(", ""}
+	}
+	info.pgxRecType = info.recType
+	info.recType = t.recType
+	info.pgValueField = t.field
+	info.pgTypeCast = t.cast
+	return info
+}
+
+// genSQLTextHelpers - the conversion of the database/sql Rec values to and
+// from their postgres text form, used by the composite types and the arrays
+func genSQLTextHelpers() {
+	ff(`// daogenScanText - sets dst from the postgres text form src, nil for NULL
+func daogenScanText(dst sql.Scanner, src []byte) error {
+	if src == nil {
+		return dst.Scan(nil)
+	}
+	switch dst := dst.(type) {
+	case *sql.NullTime:
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999Z07", "2006-01-02 15:04:05.999999999Z07:00",
+			"2006-01-02 15:04:05.999999999Z07:00:00", "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+			if t, err := time.Parse(layout, string(src)); err == nil {
+				return dst.Scan(t)
+			}
+		}
+		return fmt.Errorf("invalid time %%q", src)
+	case *sql.Null[[]byte]:
+		b, err := hex.DecodeString(strings.TrimPrefix(string(src), "\\x"))
+		if err != nil {
+			return err
+		}
+		return dst.Scan(b)
+	}
+	return dst.Scan(string(src))
+}
+
+// daogenValueText - the postgres text form of the value of v, nil for NULL
+func daogenValueText(v driver.Valuer) ([]byte, error) {
+	value, err := v.Value()
+	if err != nil {
+		return nil, err
+	}
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return append([]byte{}, value...), nil
+	case []byte:
+		return []byte("\\x" + hex.EncodeToString(value)), nil
+	case int64:
+		return strconv.AppendInt([]byte{}, value, 10), nil
+	case float64:
+		if math.IsInf(value, 1) {
+			return []byte("Infinity"), nil
+		} else if math.IsInf(value, -1) {
+			return []byte("-Infinity"), nil
+		}
+		return strconv.AppendFloat([]byte{}, value, 'g', -1, 64), nil
+	case bool:
+		if value {
+			return []byte("t"), nil
+		}
+		return []byte("f"), nil
+	case time.Time:
+		return []byte(value.Format("2006-01-02 15:04:05.999999999Z07:00:00")), nil
+	}
+	return nil, fmt.Errorf("can not convert %%T to text", value)
+}
+
+// daogenScanSource - the text of a value read by a driver
+func daogenScanSource(name string, src interface{}) ([]byte, error) {
+	switch src := src.(type) {
+	case string:
+		return []byte(src), nil
+	case []byte:
+		return src, nil
+	}
+	return nil, fmt.Errorf("%%s: can not scan %%T", name, src)
+}
+
+`)
+}
+
+// genSQLArrayHelpers - the functions reading and writing the text form of
+// arrays, shared by all arrays of database/sql
+func genSQLArrayHelpers() {
+	ff(`// ArrayDimension - length and lower bound of one dimension of an array
+type ArrayDimension struct {
+	Length     int32
+	LowerBound int32
+}
+
+// daogenParseArray - splits the text form of an array into the text of its
+// elements, NULL elements as nil, and the lengths of its dimensions
+func daogenParseArray(src []byte) ([][]byte, []int32, error) {
+	s := src
+	// Explicit bounds, as in [0:1]={1,2}, are left out
+	if len(s) > 0 && s[0] == '[' {
+		i := bytes.IndexByte(s, '=')
+		if i < 0 {
+			return nil, nil, fmt.Errorf("invalid array %%q", src)
+		}
+		s = s[i+1:]
+	}
+	elems := [][]byte{}
+	// dims[d] - length of the sub arrays at depth d, counts[d] the elements
+	// of the sub array being read at depth d
+	dims := []int32{}
+	counts := []int32{}
+	depth := 0
+	for i := 0; i < len(s); {
+		switch c := s[i]; c {
+		case '{':
+			if depth > 0 {
+				counts[depth-1]++
+			}
+			if depth == len(dims) {
+				dims = append(dims, -1)
+				counts = append(counts, 0)
+			}
+			counts[depth] = 0
+			depth++
+			i++
+		case '}':
+			if depth == 0 {
+				return nil, nil, fmt.Errorf("invalid array %%q", src)
+			}
+			depth--
+			if dims[depth] < 0 {
+				dims[depth] = counts[depth]
+			} else if dims[depth] != counts[depth] {
+				return nil, nil, fmt.Errorf("invalid array %%q, sub arrays differ in length", src)
+			}
+			i++
+		case ',', ' ':
+			i++
+		default:
+			if depth == 0 {
+				return nil, nil, fmt.Errorf("invalid array %%q", src)
+			}
+			elem := []byte{}
+			if c == '"' {
+				for i++; i < len(s) && s[i] != '"'; i++ {
+					if s[i] == '\\' && i+1 < len(s) {
+						i++
+					}
+					elem = append(elem, s[i])
+				}
+				if i == len(s) {
+					return nil, nil, fmt.Errorf("invalid array %%q", src)
+				}
+				i++
+			} else {
+				start := i
+				for ; i < len(s) && s[i] != ',' && s[i] != '}'; i++ {
+					if s[i] == '\\' && i+1 < len(s) {
+						i++
+					}
+					elem = append(elem, s[i])
+				}
+				if strings.EqualFold(string(s[start:i]), "NULL") {
+					elem = nil
+				}
+			}
+			elems = append(elems, elem)
+			counts[depth-1]++
+		}
+	}
+	if depth != 0 {
+		return nil, nil, fmt.Errorf("invalid array %%q", src)
+	}
+	if len(elems) == 0 {
+		return elems, nil, nil
+	}
+	return elems, dims, nil
+}
+
+// daogenFormatArray - the text form of an array with the given element
+// texts and dimension lengths. nil elements are written as NULL
+func daogenFormatArray(elems [][]byte, dims []int32) []byte {
+	if len(elems) == 0 || len(dims) == 0 {
+		return []byte("{}")
+	}
+	// counts[i] - number of elements in one sub array of dimension i
+	counts := make([]int, len(dims))
+	counts[len(counts)-1] = int(dims[len(dims)-1])
+	for i := len(counts) - 2; i >= 0; i-- {
+		counts[i] = int(dims[i]) * counts[i+1]
+	}
+	buf := []byte{}
+	for i, elem := range elems {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		for _, n := range counts {
+			if i%%n == 0 {
+				buf = append(buf, '{')
+			}
+		}
+		switch {
+		case elem == nil:
+			buf = append(buf, "NULL"...)
+		case len(elem) > 0 && !strings.EqualFold(string(elem), "NULL") && bytes.IndexAny(elem, "{}\",\\ \t\n\r\v\f") < 0:
+			buf = append(buf, elem...)
+		default:
+			buf = append(buf, '"')
+			for _, b := range elem {
+				if b == '"' || b == '\\' {
+					buf = append(buf, '\\')
+				}
+				buf = append(buf, b)
+			}
+			buf = append(buf, '"')
+		}
+		for _, n := range counts {
+			if (i+1)%%n == 0 {
+				buf = append(buf, '}')
+			}
+		}
+	}
+	return buf
+}
+
+`)
+}
+
+// genSQLTextArray - an array type holding elements of the given Rec type
+// for database/sql, read and written in the text format
+func genSQLTextArray(name string, elemRecType string) {
+	ff(`// %s - array of %s, read and written in text format
+type %s struct {
+	Elements []%s
+	Dims     []ArrayDimension
+	Valid    bool
+}
+
+// Scan - implements sql.Scanner
+func (a *%s) Scan(src interface{}) error {
+	if src == nil {
+		*a = %s{}
+		return nil
+	}
+	text, err := daogenScanSource("%s", src)
+	if err != nil {
+		return err
+	}
+	elems, dims, err := daogenParseArray(text)
+	if err != nil {
+		return err
+	}
+	elements := make([]%s, len(elems))
+	for i, elem := range elems {
+		if err = daogenScanText(&elements[i], elem); err != nil {
+			return err
+		}
+	}
+	*a = %s{Elements: elements, Valid: true}
+	for _, n := range dims {
+		a.Dims = append(a.Dims, ArrayDimension{Length: n, LowerBound: 1})
+	}
+	return nil
+}
+
+// Value - implements driver.Valuer
+func (a %s) Value() (driver.Value, error) {
+	if !a.Valid {
+		return nil, nil
+	}
+	var err error
+	elems := make([][]byte, len(a.Elements))
+	for i := range a.Elements {
+		if elems[i], err = daogenValueText(a.Elements[i]); err != nil {
+			return nil, err
+		}
+	}
+	dims := []int32{}
+	for _, d := range a.Dims {
+		dims = append(dims, d.Length)
+	}
+	return string(daogenFormatArray(elems, dims)), nil
+}
+
+`, name, elemRecType, name, elemRecType, name, name, name, elemRecType, name, name)
+}
+
+// genSQLComposite - the go struct of a composite type and its Rec for
+// database/sql. The Rec implements sql.Scanner and driver.Valuer on the text
+// form of the composite value
+func genSQLComposite(c *CompositeDesc) {
+	goName := c.GoName()
+
+	//=========   Generate the struct and its Rec ===========
+	{
+		genCompositeStruct(c)
+		ff(`// %sRec - holder of %s, used in the Rec structs
+type %sRec struct {
+	V     %s
+	Valid bool
+}
+
+`, goName, goName, goName, goName)
+	}
+	//-------------------------------------
+
+	//=========   Generate Scan ===========
+	{
+		ff(`// Scan - implements sql.Scanner
+func (r *%sRec) Scan(src interface{}) error {
+	if src == nil {
+		*r = %sRec{}
+		return nil
+	}
+	text, err := daogenScanSource("%s", src)
+	if err != nil {
+		return err
+	}
+	fields, err := daogenParseRecord(text)
+	if err != nil {
+		return err
+	}
+	if len(fields) != %d {
+		return fmt.Errorf("%s: expected %d fields, got %%d", len(fields))
+	}
+	r.V = %s{}
+`, goName, goName, goName, len(c.Attributes), goName, len(c.Attributes), goName)
+		for i := range c.Attributes {
+			info := c.Attributes[i].goInfo
+			ff("\t{\n")
+			ff("\t\tvar f %s\n", info.recType)
+			ff("\t\tif err := daogenScanText(&f, fields[%d]); err != nil {\n", i)
+			ff("\t\t\treturn err\n\t\t}\n")
+			ff("\t\tif %s {\n", info.isPresent("f"))
+			ff("\t\t\t%s\n", info.readVO("f", "r.V."+info.goColName, "return err"))
+			ff("\t\t} else {\n")
+			ff("\t\t\tr.V.%s = %s\n", info.goColName, info.nullVO())
+			ff("\t\t}\n\t}\n")
+		}
+		ff("\tr.Valid = true\n\treturn nil\n}\n\n")
+	}
+	//-------------------------------------
+
+	//=========   Generate Value ===========
+	{
+		ff(`// Value - implements driver.Valuer
+func (r %sRec) Value() (driver.Value, error) {
+	if !r.Valid {
+		return nil, nil
+	}
+	var err error
+	fields := make([][]byte, %d)
+`, goName, len(c.Attributes))
+		for i := range c.Attributes {
+			info := c.Attributes[i].goInfo
+			ff("\t{\n")
+			ff("\t\tvar f %s\n", info.recType)
+			ff("\t\t%s\n", info.setPresent("f"))
+			ff("\t\t%s\n", info.toRecord("f", "r.V."+info.goColName, "return nil, err"))
+			ff("\t\tif fields[%d], err = daogenValueText(f); err != nil {\n", i)
+			ff("\t\t\treturn nil, err\n\t\t}\n\t}\n")
+		}
+		ff("\treturn string(daogenFormatRecord(nil, fields)), nil\n}\n\n")
+	}
+	//-------------------------------------
+}
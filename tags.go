@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tagNamings - the accepted Naming values of a tag set. column (the default)
+// uses the column name as is
+var tagNamings = map[string]bool{
+	"": true, "column": true, "snake_case": true, "camelCase": true, "PascalCase": true, "kebab-case": true,
+}
+
+// checkTagConfig - validates the Tags section of the config
+func checkTagConfig(tags *Tags) error {
+	for _, set := range tags.Sets {
+		if len(set.Name) == 0 {
+			return fmt.Errorf("tag set without Name")
+		}
+		if !tagNamings[set.Naming] {
+			return fmt.Errorf("unknown Naming %q of tag set %s", set.Naming, set.Name)
+		}
+	}
+	return nil
+}
+
+// splitWords - the words of a column name, split at non alphanumeric
+// characters and at the start of upper case humps
+func splitWords(name string) []string {
+	words := []string{}
+	word := []rune{}
+	var prev rune
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = []rune{}
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) && len(word) > 0:
+			words = append(words, string(word))
+			word = []rune{r}
+		default:
+			word = append(word, r)
+		}
+		prev = r
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// tagName - the column name in the naming strategy of a tag set
+func tagName(naming string, column string) string {
+	words := splitWords(column)
+	for i := range words {
+		words[i] = strings.ToLower(words[i])
+	}
+	switch naming {
+	case "snake_case":
+		return strings.Join(words, "_")
+	case "kebab-case":
+		return strings.Join(words, "-")
+	case "camelCase", "PascalCase":
+		name := ""
+		for i, w := range words {
+			if i > 0 || naming == "PascalCase" {
+				w = strings.ToUpper(w[:1]) + w[1:]
+			}
+			name += w
+		}
+		return name
+	}
+	return column
+}
+
+// columnTags - the tag options of the column, nil if there are none. owner
+// is the table, query or composite type name
+func (tags *Tags) columnTags(schema string, owner string, col *ColDesc) *ColumnTags {
+	name := owner + "." + col.ColumnName
+	for i := range tags.Columns {
+		if tags.Columns[i].Column == name || tags.Columns[i].Column == schema+"."+name {
+			return &tags.Columns[i]
+		}
+	}
+	return nil
+}
+
+// voTag - the struct tag of the VO field of the column, "" if no tag sets
+// are configured. checks are the CHECK constraints of the table
+func (meta *DBMeta) voTag(schema string, owner string, col *ColDesc, checks []ConstraintDesc) string {
+	if meta.tags == nil || len(meta.tags.Sets) == 0 {
+		return ""
+	}
+	colTags := meta.tags.columnTags(schema, owner, col)
+	parts := []string{}
+	for _, set := range meta.tags.Sets {
+		value := ""
+		switch {
+		case colTags != nil && colTags.Ignore:
+			value = "-"
+		case set.Name == "validate":
+			value = validateRules(col, checks)
+		default:
+			value = tagName(set.Naming, col.ColumnName)
+			if set.OmitEmpty || (colTags != nil && colTags.OmitEmpty) {
+				value += ",omitempty"
+			}
+		}
+		if v, ok := colTags.value(set.Name); ok {
+			value = v
+		}
+		if len(value) > 0 {
+			parts = append(parts, fmt.Sprintf("%s:%q", set.Name, value))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " `" + strings.Join(parts, " ") + "`"
+}
+
+// value - the tag value configured for the tag set, if any
+func (c *ColumnTags) value(set string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	v, ok := c.Values[set]
+	return v, ok
+}
+
+// validateRules - go-playground/validator rules derived from NOT NULL, the
+// maximum length and simple single column CHECK constraints. Rules are only
+// given where the VO can tell NULL apart: for NOT NULL columns, and behind
+// omitempty for nullable strings and pointers
+func validateRules(col *ColDesc, checks []ConstraintDesc) string {
+	info := &col.goInfo
+	plain := info
+	if info.inner != nil {
+		plain = info.inner
+	}
+	if plain.array != nil || plain.override != nil || plain.composite != nil ||
+		(info.inner != nil && info.nullMode != "pointer") {
+		return ""
+	}
+	isString := plain.pgValueField == "String"
+	isNumber := plain.pgValueField == "Int" || plain.pgValueField == "Float" || plain.pgValueField == "Uint"
+	notNull := !col.IsNullable || (info.domain != nil && info.domain.NotNull)
+	if !notNull && info.inner == nil && !isString {
+		return ""
+	}
+
+	rules := []string{}
+	hasDefault := len(col.ColumnDefault) > 0 || col.IsIdentity || col.IsGenerated
+	if notNull && !hasDefault && (isString || (plain.pgValueField == "Time" && plain.voType == "time.Time")) {
+		rules = append(rules, "required")
+	}
+
+	// The CHECK constraints of a domain refer to the column as VALUE
+	typeCol := col
+	terms := map[string][]string{}
+	for _, con := range checks {
+		if con.Type == "CHECK" && len(con.Columns) == 1 && con.Columns[0] == col.ColumnName {
+			terms[col.ColumnName] = append(terms[col.ColumnName], checkTerms(con.Definition)...)
+		}
+	}
+	if d := info.domain; d != nil {
+		typeCol = &d.BaseType
+		for _, con := range d.Checks {
+			terms["value"] = append(terms["value"], checkTerms(con.Definition)...)
+		}
+	}
+	if bt := lookupColType(typeCol); bt != nil && (bt.typName == "varchar" || bt.typName == "bpchar") &&
+		typeCol.TypeMod > 4 {
+		rules = append(rules, fmt.Sprintf("max=%d", typeCol.TypeMod-4))
+	}
+	for _, name := range []string{col.ColumnName, "value"} {
+		for _, term := range terms[name] {
+			if rule := checkRule(term, name, isString, isNumber); len(rule) > 0 {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	if !notNull {
+		rules = append([]string{"omitempty"}, rules...)
+	}
+	return strings.Join(rules, ",")
+}
+
+var (
+	castPattern       = regexp.MustCompile(`(?i)::(character varying|double precision|bit varying|(timestamp|time) with(out)? time zone|[a-z_]+)(\[\])?`)
+	literalPattern    = regexp.MustCompile(`(^|[\s(])\((-?[0-9.]+|'[^']*'|"?\w+"?)\)`)
+	comparePattern    = regexp.MustCompile(`^"?(\w+)"? (>=|>|<=|<|<>|!=|=) (-?[0-9.]+)$`)
+	compareRevPattern = regexp.MustCompile(`^(-?[0-9.]+) (>=|>|<=|<|<>|!=|=) "?(\w+)"?$`)
+	lengthPattern     = regexp.MustCompile(`(?i)^(?:char_length|character_length|length)\("?(\w+)"?\) (>=|>|<=|<|=) ([0-9]+)$`)
+	inPattern         = regexp.MustCompile(`(?i)^"?(\w+)"? (?:in \((.*)\)|= any \(array\[(.*)\]\))$`)
+)
+
+// checkTerms - the terms of a CHECK constraint joined by AND, with casts
+// and redundant parentheses removed
+func checkTerms(def string) []string {
+	expr := strings.TrimSpace(def)
+	if strings.HasPrefix(strings.ToUpper(expr), "CHECK") {
+		expr = expr[len("CHECK"):]
+	}
+	return splitAnd(stripParens(castPattern.ReplaceAllString(expr, "")))
+}
+
+// splitAnd - splits the expression at the ANDs outside of parentheses,
+// recursing into the parts
+func splitAnd(expr string) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ' ':
+			if depth == 0 && len(expr) > i+5 && strings.EqualFold(expr[i:i+5], " and ") {
+				parts = append(parts, expr[start:i])
+				start = i + 5
+			}
+		}
+	}
+	if start == 0 {
+		return []string{expr}
+	}
+	terms := []string{}
+	for _, part := range append(parts, expr[start:]) {
+		terms = append(terms, splitAnd(stripParens(part))...)
+	}
+	return terms
+}
+
+// stripParens - removes parentheses around the whole expression and around
+// single literals and identifiers
+func stripParens(expr string) string {
+	expr = strings.TrimSpace(expr)
+	for strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") {
+		depth := 0
+		for i := 0; i < len(expr)-1 && depth >= 0; i++ {
+			if expr[i] == '(' {
+				depth++
+			} else if expr[i] == ')' {
+				depth--
+			}
+			if depth == 0 {
+				depth = -1
+			}
+		}
+		if depth < 0 {
+			break
+		}
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+	return literalPattern.ReplaceAllString(expr, "$1$2")
+}
+
+var compareRules = map[string]string{">=": "gte", ">": "gt", "<=": "lte", "<": "lt", "<>": "ne", "!=": "ne", "=": "eq"}
+var flippedOps = map[string]string{">=": "<=", ">": "<", "<=": ">=", "<": ">", "<>": "<>", "!=": "!=", "=": "="}
+
+// checkRule - the validator rule for a single CHECK term on the column, ""
+// if it is not understood
+func checkRule(term string, colName string, isString bool, isNumber bool) string {
+	if m := comparePattern.FindStringSubmatch(term); m != nil && strings.EqualFold(m[1], colName) && isNumber {
+		return compareRules[m[2]] + "=" + m[3]
+	}
+	if m := compareRevPattern.FindStringSubmatch(term); m != nil && strings.EqualFold(m[3], colName) && isNumber {
+		return compareRules[flippedOps[m[2]]] + "=" + m[1]
+	}
+	if m := lengthPattern.FindStringSubmatch(term); m != nil && strings.EqualFold(m[1], colName) && isString {
+		n, _ := strconv.Atoi(m[3])
+		switch m[2] {
+		case ">=":
+			return fmt.Sprintf("min=%d", n)
+		case ">":
+			return fmt.Sprintf("min=%d", n+1)
+		case "<=":
+			return fmt.Sprintf("max=%d", n)
+		case "<":
+			return fmt.Sprintf("max=%d", n-1)
+		}
+		return fmt.Sprintf("len=%d", n)
+	}
+	if m := inPattern.FindStringSubmatch(term); m != nil && strings.EqualFold(m[1], colName) && (isString || isNumber) {
+		values := []string{}
+		for _, v := range strings.Split(m[2]+m[3], ",") {
+			v = strings.TrimSpace(v)
+			if strings.HasPrefix(v, "'") && strings.HasSuffix(v, "'") && len(v) > 1 {
+				v = v[1 : len(v)-1]
+			}
+			if len(v) == 0 || strings.ContainsAny(v, " '\"") {
+				return ""
+			}
+			values = append(values, v)
+		}
+		return "oneof=" + strings.Join(values, " ")
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// The default templates. table.tmpl generates the table objects and
+// query.tmpl the query objects. Every generated method is a named template,
+// so that it can be replaced on its own. The templates of pgx/v5 are in
+// templates/pgx5, those of database/sql in templates/sql. Both share
+// common.tmpl
+//
+//go:embed templates/*.tmpl templates/pgx5/*.tmpl templates/sql/*.tmpl
+var defaultTemplates embed.FS
+
+// templateFuncs - the functions available to the templates besides the
+// text/template builtins
+var templateFuncs = template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}
+
+// loadTemplates - parses the default templates of the target, then the
+// *.tmpl files of dir if one is given. A template defined in dir replaces the
+// default one of the same name
+func loadTemplates(dir string, target string) (*template.Template, error) {
+	patterns := []string{"templates/*.tmpl"}
+	if len(target) > 0 {
+		patterns = []string{"templates/common.tmpl", "templates/" + target + "/*.tmpl"}
+	}
+	tmpl, err := template.New("daogen").Funcs(templateFuncs).ParseFS(defaultTemplates, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	if len(dir) == 0 {
+		return tmpl, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range files {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = tmpl.New(filepath.Base(file)).Parse(string(text)); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+// executeTemplate - generates the named template into w
+func executeTemplate(w io.Writer, tmpl *template.Template, name string, data interface{}) error {
+	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
+		return fmt.Errorf("template %s: %v", name, err)
+	}
+	return nil
+}
+
+// TableData - what the table templates are executed with
+type TableData struct {
+	Package    string // name of the generated package
+	Name       string // schema qualified table name
+	GoName     string // go name of the table, prefix of the generated types
+	Kind       string // table, view or matview
+	ReadOnly   bool   // views and materialized views have no Insert, Update, Upsert or Delete
+	HasTime    bool   // a VO field is of a time type
+	HasVersion bool   // the table has a version column
+	Imports    string // the import lines of type overrides
+
+	Columns    []ColumnData // all columns in table order
+	PrimaryKey []ColumnData // the primary key columns
+	Insert     []ColumnData // the columns bound by the Insert statement
+	Returning  []ColumnData // the columns returned by the Insert statement
+	Update     []ColumnData // the columns bound by the Update statement, then the key
+	EnumChecks []EnumCheck  // the enum columns checked by Validate
+
+	Statements []Statement // the prepared statements, keyed GoName + suffix
+	SelectAll  string      // the SELECT without WHERE, used by SelectFor
+	Finders    []FinderData
+	Upserts    []UpsertData
+
+	Sequence       string     // sequence for Genkey, "" if there is none
+	SequencePrefix string     // prefix of the keys made by Genkey
+	KeyColumn      ColumnData // the column Genkey sets
+
+	References   []RelationData // foreign keys of this table
+	ReferencedBy []RelationData // foreign keys referring to this table
+}
+
+// ColumnData - a column of a table or a query. The conversions are go code
+// between the Record field t.Record.<GoName> and the VO
+type ColumnData struct {
+	Name        string // column name
+	GoName      string // field name in the VO and the Rec
+	ParamName   string // name used for the column as a parameter
+	VOType      string // type of the VO field
+	PlainVOType string // VOType without the null wrapper, used for parameters
+	RecType     string // pgtype type of the Rec field
+	Present     string // condition on the Record field not being NULL
+	SetPresent  string // statement marking the Record field as not NULL
+	Tag         string // struct tag of the VO field, with a leading space
+	Nullable    bool
+	FromRecord  string // expression converting the Record field for the VO, unless GetFails
+	ReadVO      string // statement setting t.VO.<GoName> from the Record field, returning nil, err on failure
+	GetVO       string // ReadVO returning NullVO, err on failure
+	GetFails    bool   // the conversion from the Record field can fail, so Get<GoName> returns an error
+	NullVO      string // the VO value of NULL
+	ToRecord    string // statement setting the Record field from t.VO.<GoName>, returning nil, err on failure
+	SetRecord   string // statement setting the Record field from value, returning err on failure
+	SetFails    bool   // the conversion to the Record field can fail, so Set<GoName> returns an error
+}
+
+// EnumCheck - the condition Validate puts on an enum column. Cond is empty
+// or ends in &&, Value is checked with Valid and Label is the printed value
+type EnumCheck struct {
+	GoName string
+	Cond   string
+	Value  string
+	Label  string
+}
+
+// Statement - a prepared statement of the table object
+type Statement struct {
+	Key string
+	SQL string
+}
+
+// FinderData - a select method for a unique key or an index
+type FinderData struct {
+	Method  string
+	Index   string // name of the index
+	Unique  bool   // unique finders read a single row
+	Columns []ColumnData
+}
+
+// UpsertData - an upsert method on the primary key or a unique key
+type UpsertData struct {
+	Method string
+	Index  string       // name of the unique index, "" for the primary key
+	Insert []ColumnData // the columns bound by the statement
+}
+
+// RelationData - a foreign key navigation method. Table is the other side
+// of the relation, Where the condition on its columns and Columns the columns
+// of this table giving the arguments
+type RelationData struct {
+	Method     string
+	Table      string
+	GoName     string
+	Constraint string
+	Where      string
+	Columns    []ColumnData
+}
+
+// QueryData - what the query templates are executed with
+type QueryData struct {
+	Package string
+	Name    string // name of the query in the config
+	GoName  string
+	Query   string
+	Imports string
+	Columns []ColumnData
+}
+
+// columnData - the template data of a column
+func columnData(col *ColDesc) ColumnData {
+	info := &col.goInfo
+	rec := "t.Record." + info.goColName
+	return ColumnData{
+		Name:        col.ColumnName,
+		GoName:      info.goColName,
+		ParamName:   goParamName(col.ColumnName),
+		VOType:      info.voType,
+		PlainVOType: info.plainVOType(),
+		RecType:     info.recType,
+		Present:     info.isPresent(rec),
+		SetPresent:  info.setPresent(rec),
+		Tag:         info.tag,
+		Nullable:    col.IsNullable,
+		FromRecord:  info.fromRecord(rec),
+		ReadVO:      info.readVO(rec, "t.VO."+info.goColName, "return nil, err"),
+		GetVO:       info.readVO(rec, "t.VO."+info.goColName, "return "+info.nullVO()+", err"),
+		GetFails:    info.fromFails(),
+		NullVO:      info.nullVO(),
+		ToRecord:    info.toRecord(rec, "t.VO."+info.goColName, "return nil, err"),
+		SetRecord:   info.toRecord(rec, "value", "return err"),
+		SetFails:    info.toFails(),
+	}
+}
+
+// columnsData - the template data of the columns at the given indexes
+func columnsData(cols []ColDesc, subs []int) []ColumnData {
+	data := []ColumnData{}
+	for _, i := range subs {
+		data = append(data, columnData(&cols[i]))
+	}
+	return data
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeModes - the accepted TimeMode values of the config. string keeps time
+// based columns as strings in the VO, time makes them time.Time
+var timeModes = map[string]bool{"": true, "string": true, "time": true}
+
+// timeLayout - go expression for the layout of the VO string of a time
+// based column
+func (g *GoColInfo) timeLayout() string {
+	if g.baseRecType() == "pgtype.Date" {
+		return `"2006-01-02"`
+	}
+	return "time.RFC3339Nano"
+}
+
+// isWallTime - true for date and timestamp, which hold a wall clock time
+// without time zone
+func (g *GoColInfo) isWallTime() bool {
+	return g.baseRecType() != "pgtype.Timestamptz"
+}
+
+// timeFromRecord - go expression converting the time of the pgtype value rec
+// to the VO type, in the time zone daogenTimeZone
+func (g *GoColInfo) timeFromRecord(rec string) string {
+	t := rec + ".Time.In(daogenTimeZone)"
+	if g.isWallTime() {
+		t = "daogenFromWallTime(" + rec + ".Time)"
+	}
+	if g.voType == "time.Time" {
+		return t
+	}
+	return fmt.Sprintf("%s.Format(%s)", t, g.timeLayout())
+}
+
+// timeToRecord - statement setting the time of the pgtype value rec from the
+// VO value. Zero times and empty strings are written as NULL if the column is
+// nullable. Strings that can not be parsed, and empty strings for NOT NULL
+// columns, run fail
+func (g *GoColInfo) timeToRecord(rec string, value string, fail string) string {
+	t := "tm"
+	if g.isWallTime() {
+		t = "daogenToWallTime(tm)"
+	}
+	if g.voType == "time.Time" {
+		if !g.nullable {
+			return fmt.Sprintf("%s.Time = %s", rec, strings.Replace(t, "tm", value, 1))
+		}
+		return fmt.Sprintf("if tm := %s; tm.IsZero() { %s } else { %s.Time = %s }",
+			value, g.setNull(rec), rec, t)
+	}
+	parse := fmt.Sprintf("if tm, err := time.Parse(%s, %s); err != nil { %s } else { %s.Time = %s }",
+		g.timeLayout(), value, fail, rec, t)
+	if !g.nullable {
+		return parse
+	}
+	return fmt.Sprintf(`if %s == "" { %s } else %s`, value, g.setNull(rec), parse)
+}
+
+// checkTimeConfig - validates TimeMode and TimeZone of the config
+func checkTimeConfig(v *Genstruct) error {
+	if !timeModes[v.TimeMode] {
+		return fmt.Errorf("unknown TimeMode %q, expected string or time", v.TimeMode)
+	}
+	if _, err := time.LoadLocation(v.TimeZone); err != nil {
+		return fmt.Errorf("unknown TimeZone %q: %v", v.TimeZone, err)
+	}
+	return nil
+}
+
+// genTimeHelpers - the time zone of the VO and the conversion of wall clock
+// times, shared by all time based columns. zone is the TimeZone of the
+// config, UTC if empty
+func genTimeHelpers(zone string) {
+	switch zone {
+	case "", "UTC":
+		ff("// daogenTimeZone - time zone of the times in the VO\nvar daogenTimeZone = time.UTC\n\n")
+	case "Local":
+		ff("// daogenTimeZone - time zone of the times in the VO\nvar daogenTimeZone = time.Local\n\n")
+	default:
+		ff(`// daogenTimeZone - time zone of the times in the VO
+var daogenTimeZone = daogenLoadTimeZone(%q)
+
+// daogenLoadTimeZone - loads the named time zone, panics if it is unknown
+func daogenLoadTimeZone(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic("daogen: " + err.Error())
+	}
+	return loc
+}
+
+`, zone)
+	}
+	ff(`// daogenFromWallTime - the wall clock time of a date or timestamp, which
+// pgtype reads as UTC, in daogenTimeZone
+func daogenFromWallTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(),
+		t.Nanosecond(), daogenTimeZone)
+}
+
+// daogenToWallTime - the wall clock time of t in daogenTimeZone, as the UTC
+// time pgtype writes to a date or timestamp
+func daogenToWallTime(t time.Time) time.Time {
+	t = t.In(daogenTimeZone)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(),
+		t.Nanosecond(), time.UTC)
+}
+
+`)
+}
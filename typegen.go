@@ -0,0 +1,499 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// usedTypes - the user defined types and array conversions needed by the
+// generated tables and queries. textCoded is set if daogenEncodeText is used
+type usedTypes struct {
+	DBMeta
+	arrays     map[string]*ArrayInfo
+	textArrays map[string]string
+	overrides  map[string]GoColInfo
+	textCoded  bool
+	times      bool
+	nullMode   string
+}
+
+func newUsedTypes() *usedTypes {
+	return &usedTypes{
+		DBMeta: DBMeta{Enums: map[string]*EnumDesc{}, Composites: map[string]*CompositeDesc{},
+			Domains: map[string]*DomainDesc{}},
+		arrays:     map[string]*ArrayInfo{},
+		textArrays: map[string]string{},
+		overrides:  map[string]GoColInfo{},
+	}
+}
+
+// isEmpty - true if no Types.go is needed
+func (used *usedTypes) isEmpty() bool {
+	return len(used.Enums)+len(used.Composites)+len(used.Domains)+len(used.arrays)+
+		len(used.overrides) == 0 && !used.textCoded && !used.times && used.nullMode == ""
+}
+
+// addUsedTypes - records the user defined types and arrays the column
+// depends on, following the base types of domains, the attributes of
+// composite types and the elements of arrays. Arrays with an overridden VO
+// type need no conversions of their own
+func (used *usedTypes) addUsedTypes(info *GoColInfo) {
+	if info.inner != nil {
+		if info.nullMode == "pointer" || info.nullMode == "optional" {
+			used.nullMode = info.nullMode
+		}
+		used.addUsedTypes(info.inner)
+		return
+	}
+	if info.textEncoded() {
+		used.textCoded = true
+	}
+	if info.pgValueField == "Time" {
+		used.times = true
+	}
+	if info.override != nil {
+		used.overrides[info.overrideFunc("From")] = *info
+	}
+	if a := info.array; a != nil {
+		if info.override == nil {
+			used.arrays[a.toVOFunc()] = a
+		}
+		if a.isTextArray() {
+			used.textArrays[a.recType] = a.elem.recType
+		}
+		used.addUsedTypes(&a.elem)
+		return
+	}
+	if info.enum != nil {
+		used.Enums[info.enum.QualifiedName()] = info.enum
+	}
+	if info.domain != nil {
+		used.Domains[info.domain.QualifiedName()] = info.domain
+	}
+	if c := info.composite; c != nil {
+		if _, ok := used.Composites[c.QualifiedName()]; ok {
+			return
+		}
+		used.Composites[c.QualifiedName()] = c
+		for i := range c.Attributes {
+			used.addUsedTypes(&c.Attributes[i].goInfo)
+		}
+	}
+}
+
+// enumConstName - go constant name for an enum label. Characters that can
+// not be part of an identifier act as word separators
+func enumConstName(e *EnumDesc, label string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, label)
+	cleaned = strings.Trim(cleaned, "_")
+	if len(cleaned) == 0 {
+		return e.GoName() + "Empty"
+	}
+	return e.GoName() + convertCase(cleaned)
+}
+
+// genUserTypes - generates the go types for the enums, domains and composite
+// types in used, along with the array conversions. meta is needed to resolve
+// the base types of domains
+func genUserTypes(meta *DBMeta, used *usedTypes) {
+
+	//=========   Generate the imports ===========
+	{
+		imports := map[string]bool{}
+		if len(used.Enums) > 0 {
+			imports[`"database/sql/driver"`] = true
+			imports[`"fmt"`] = true
+		}
+		if len(used.Composites)+len(used.arrays) > 0 {
+			imports[`"fmt"`] = true
+		}
+		if len(used.Composites)+len(used.arrays)+len(used.overrides) > 0 || used.textCoded {
+			imports[`"github.com/jackc/pgx/pgtype"`] = true
+		}
+		switch meta.target() {
+		case "pgx5":
+			delete(imports, `"github.com/jackc/pgx/pgtype"`)
+			imports[`"database/sql"`] = true
+			imports[`"database/sql/driver"`] = true
+			imports[`"fmt"`] = true
+			imports[`"github.com/jackc/pgx/v5/pgtype"`] = true
+		case "sql":
+			delete(imports, `"github.com/jackc/pgx/pgtype"`)
+			for _, name := range []string{`"bytes"`, `"database/sql"`, `"database/sql/driver"`,
+				`"encoding/hex"`, `"fmt"`, `"math"`, `"strconv"`, `"strings"`, `"time"`} {
+				imports[name] = true
+			}
+		}
+		if used.times {
+			imports[`"time"`] = true
+		}
+		if used.nullMode == "optional" {
+			imports[`"database/sql/driver"`] = true
+		}
+		for _, c := range used.Composites {
+			for _, attr := range c.Attributes {
+				attr.goInfo.addImports(imports)
+			}
+		}
+		for _, a := range used.arrays {
+			a.elem.addImports(imports)
+		}
+		for _, info := range used.overrides {
+			if info.isJSON {
+				imports[`"encoding/json"`] = true
+			}
+			info.addImports(imports)
+		}
+		names := []string{}
+		for name := range imports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ff("import (\n")
+		for _, name := range names {
+			ff("\t%s\n", name)
+		}
+		ff(")\n\n")
+	}
+	//-------------------------------------
+
+	for _, e := range used.sortedEnums() {
+		genEnum(e)
+	}
+	for _, d := range used.sortedDomains() {
+		genDomain(meta, d)
+	}
+	for _, c := range used.sortedComposites() {
+		switch meta.target() {
+		case "pgx5":
+			genPgx5Composite(c)
+		case "sql":
+			genSQLComposite(c)
+		default:
+			genComposite(c)
+		}
+	}
+	for _, name := range sortedKeys(used.textArrays) {
+		if meta.target() == "sql" {
+			genSQLTextArray(name, used.textArrays[name])
+		} else {
+			genTextArray(name, used.textArrays[name])
+		}
+	}
+	arrayFuncs := []string{}
+	for name := range used.arrays {
+		arrayFuncs = append(arrayFuncs, name)
+	}
+	sort.Strings(arrayFuncs)
+	for _, name := range arrayFuncs {
+		genArrayFuncs(used.arrays[name])
+	}
+	overrideFuncs := []string{}
+	for name := range used.overrides {
+		overrideFuncs = append(overrideFuncs, name)
+	}
+	sort.Strings(overrideFuncs)
+	for _, name := range overrideFuncs {
+		genOverrideFuncs(used.overrides[name])
+	}
+	if len(used.Composites) > 0 {
+		genRecordHelpers()
+	}
+	switch {
+	case meta.target() == "sql":
+		if len(used.textArrays) > 0 {
+			genSQLArrayHelpers()
+		}
+		if len(used.textArrays)+len(used.Composites) > 0 {
+			genSQLTextHelpers()
+		}
+	case meta.target() == "pgx5":
+		if used.textCoded || len(used.Composites) > 0 {
+			genPgx5TextHelpers()
+		}
+	case used.textCoded:
+		ff(`// daogenEncodeText - text representation of a pgtype value, "" for NULL
+func daogenEncodeText(v pgtype.TextEncoder) (string, error) {
+	buf, err := v.EncodeText(nil, nil)
+	return string(buf), err
+}
+
+`)
+	}
+	if used.times {
+		genTimeHelpers(meta.timeZone)
+	}
+	genNullHelpers(used.nullMode)
+}
+
+// sortedKeys - keys of a string map in a stable order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func genEnum(e *EnumDesc) {
+	goName := e.GoName()
+	constNames := []string{}
+	seen := map[string]bool{}
+	for _, label := range e.Labels {
+		name := enumConstName(e, label)
+		for n := 2; seen[name]; n++ {
+			name = fmt.Sprintf("%s%d", enumConstName(e, label), n)
+		}
+		seen[name] = true
+		constNames = append(constNames, name)
+	}
+
+	//=========   Generate the type and the constants ===========
+	{
+		ff("// %s - values of the enum %s\n", goName, e.QualifiedName())
+		ff("type %s string\n\n", goName)
+		ff("const (\n")
+		for i, label := range e.Labels {
+			ff("\t%s %s = %q\n", constNames[i], goName, label)
+		}
+		ff(")\n\n")
+		ff("// %sValues - all labels of the enum in their sort order\n", goName)
+		ff("func %sValues() []%s {\n", goName, goName)
+		ff("\treturn []%s{%s}\n", goName, strings.Join(constNames, ", "))
+		ff("}\n\n")
+	}
+	//-------------------------------------
+
+	//=========   Generate Valid, Scan and Value ===========
+	{
+		ff(`// Valid - true if the value is one of the labels of the enum
+func (e %s) Valid() bool {
+	switch e {
+	case %s:
+		return true
+	}
+	return false
+}
+
+// Scan - implements sql.Scanner, rejecting unknown labels
+func (e *%s) Scan(src interface{}) error {
+	var v %s
+	switch s := src.(type) {
+	case nil:
+		*e = ""
+		return nil
+	case string:
+		v = %s(s)
+	case []byte:
+		v = %s(s)
+	default:
+		return fmt.Errorf("%s: cannot scan %%T", src)
+	}
+	if !v.Valid() {
+		return fmt.Errorf("%s: invalid value %%q", string(v))
+	}
+	*e = v
+	return nil
+}
+
+// Value - implements driver.Valuer, rejecting unknown labels
+func (e %s) Value() (driver.Value, error) {
+	if !e.Valid() {
+		return nil, fmt.Errorf("%s: invalid value %%q", string(e))
+	}
+	return string(e), nil
+}
+
+`, goName, strings.Join(constNames, ", "), goName, goName, goName, goName, goName, goName,
+			goName, goName)
+	}
+	//-------------------------------------
+}
+
+func genDomain(meta *DBMeta, d *DomainDesc) {
+	goName := d.GoName()
+	base := meta.goColInfo(&d.BaseType)
+	if d.hasNamedType(&base) {
+		ff("// %s - domain %s\n", goName, d.QualifiedName())
+		ff("type %s %s\n\n", goName, base.voType)
+	}
+	ff("// %sChecks - CHECK constraints of the domain %s\n", goName, d.QualifiedName())
+	if len(d.Checks) == 0 {
+		ff("var %sChecks = []string{}\n\n", goName)
+		return
+	}
+	ff("var %sChecks = []string{\n", goName)
+	for _, con := range d.Checks {
+		ff("\t%q,\n", con.Definition)
+	}
+	ff("}\n\n")
+}
+
+// genCompositeStruct - the go struct of a composite type
+func genCompositeStruct(c *CompositeDesc) {
+	ff("// %s - composite type %s\n", c.GoName(), c.QualifiedName())
+	ff("type %s struct {\n", c.GoName())
+	for _, attr := range c.Attributes {
+		ff("\t%-30s%s%s\n", attr.goInfo.goColName, attr.goInfo.voType, attr.goInfo.tag)
+	}
+	ff("}\n\n")
+}
+
+func genComposite(c *CompositeDesc) {
+	goName := c.GoName()
+
+	//=========   Generate the struct and its Rec ===========
+	{
+		genCompositeStruct(c)
+		ff(`// %sRec - pgtype compatible holder of %s, used in the Rec structs
+type %sRec struct {
+	Value  %s
+	Status pgtype.Status
+}
+
+`, goName, goName, goName, goName)
+	}
+	//-------------------------------------
+
+	//=========   Generate DecodeText ===========
+	{
+		ff(`// DecodeText - implements pgtype.TextDecoder
+func (r *%sRec) DecodeText(ci *pgtype.ConnInfo, src []byte) error {
+	if src == nil {
+		*r = %sRec{Status: pgtype.Null}
+		return nil
+	}
+	fields, err := daogenParseRecord(src)
+	if err != nil {
+		return err
+	}
+	if len(fields) != %d {
+		return fmt.Errorf("%s: expected %d fields, got %%d", len(fields))
+	}
+	r.Value = %s{}
+`, goName, goName, len(c.Attributes), goName, len(c.Attributes), goName)
+		for i, attr := range c.Attributes {
+			info := attr.goInfo
+			ff("\t{\n")
+			ff("\t\tvar f %s\n", info.recType)
+			ff("\t\tif err := f.DecodeText(ci, fields[%d]); err != nil {\n", i)
+			ff("\t\t\treturn err\n\t\t}\n")
+			ff("\t\tif f.Status == pgtype.Present {\n")
+			ff("\t\t\t%s\n", info.readVO("f", "r.Value."+info.goColName, "return err"))
+			ff("\t\t} else {\n")
+			ff("\t\t\tr.Value.%s = %s\n", info.goColName, info.nullVO())
+			ff("\t\t}\n\t}\n")
+		}
+		ff("\tr.Status = pgtype.Present\n\treturn nil\n}\n\n")
+	}
+	//-------------------------------------
+
+	//=========   Generate EncodeText ===========
+	{
+		ff(`// EncodeText - implements pgtype.TextEncoder
+func (r %sRec) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	if r.Status != pgtype.Present {
+		return nil, nil
+	}
+	var err error
+	fields := make([][]byte, %d)
+`, goName, len(c.Attributes))
+		for i, attr := range c.Attributes {
+			info := attr.goInfo
+			ff("\t{\n")
+			ff("\t\tvar f %s\n", info.recType)
+			ff("\t\tf.Status = pgtype.Present\n")
+			ff("\t\t%s\n", info.toRecord("f", "r.Value."+info.goColName, "return nil, err"))
+			ff("\t\tif fields[%d], err = f.EncodeText(ci, []byte{}); err != nil {\n", i)
+			ff("\t\t\treturn nil, err\n\t\t}\n\t}\n")
+		}
+		ff("\treturn daogenFormatRecord(buf, fields), nil\n}\n\n")
+	}
+	//-------------------------------------
+}
+
+// genRecordHelpers - the functions reading and writing the text form of
+// composite values, shared by all composite types
+func genRecordHelpers() {
+	ff(`// daogenParseRecord - splits the text form of a composite value into the
+// text of its fields. NULL fields are returned as nil
+func daogenParseRecord(src []byte) ([][]byte, error) {
+	if len(src) < 2 || src[0] != '(' || src[len(src)-1] != ')' {
+		return nil, fmt.Errorf("invalid composite value %%q", src)
+	}
+	body := src[1 : len(src)-1]
+	fields := [][]byte{}
+	i := 0
+	for {
+		if i >= len(body) || body[i] == ',' {
+			fields = append(fields, nil)
+		} else {
+			field := []byte{}
+			for i < len(body) && body[i] != ',' {
+				switch body[i] {
+				case '"':
+					for i++; i < len(body); i++ {
+						if body[i] == '"' {
+							if i+1 < len(body) && body[i+1] == '"' {
+								i++
+							} else {
+								break
+							}
+						} else if body[i] == '\\' && i+1 < len(body) {
+							i++
+						}
+						field = append(field, body[i])
+					}
+					i++
+				case '\\':
+					if i+1 < len(body) {
+						i++
+					}
+					fallthrough
+				default:
+					field = append(field, body[i])
+					i++
+				}
+			}
+			fields = append(fields, field)
+		}
+		if i >= len(body) {
+			return fields, nil
+		}
+		i++
+	}
+}
+
+// daogenFormatRecord - appends the text form of a composite value with the
+// given field texts to buf. nil fields are written as NULL
+func daogenFormatRecord(buf []byte, fields [][]byte) []byte {
+	buf = append(buf, '(')
+	for i, field := range fields {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		if field == nil {
+			continue
+		}
+		buf = append(buf, '"')
+		for _, c := range field {
+			if c == '"' || c == '\\' {
+				buf = append(buf, c)
+			}
+			buf = append(buf, c)
+		}
+		buf = append(buf, '"')
+	}
+	return append(buf, ')')
+}
+
+`)
+}
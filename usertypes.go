@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/pgtype"
+)
+
+// EnumDesc - a postgres enum type with its labels in sort order. OID is 0
+// when the enum was read from migration files
+type EnumDesc struct {
+	OID    uint32
+	Schema string
+	Name   string
+	Labels []string
+}
+
+// QualifiedName - schema qualified type name
+func (e *EnumDesc) QualifiedName() string {
+	return e.Schema + "." + e.Name
+}
+
+// GoName - name of the generated go type, following the same schema prefix
+// rule as tables
+func (e *EnumDesc) GoName() string {
+	if e.Schema == "public" {
+		return convertCase(e.Name)
+	}
+	return convertCase(e.Schema) + convertCase(e.Name)
+}
+
+// CompositeDesc - a postgres composite type. The attributes are described
+// like table columns, with TableName holding the type name
+type CompositeDesc struct {
+	OID        uint32
+	Schema     string
+	Name       string
+	Attributes []ColDesc
+}
+
+// QualifiedName - schema qualified type name
+func (c *CompositeDesc) QualifiedName() string {
+	return c.Schema + "." + c.Name
+}
+
+// GoName - name of the generated go struct
+func (c *CompositeDesc) GoName() string {
+	if c.Schema == "public" {
+		return convertCase(c.Name)
+	}
+	return convertCase(c.Schema) + convertCase(c.Name)
+}
+
+// DomainDesc - a postgres domain. BaseType describes the underlying type
+// like a column, Checks holds the CHECK constraints of the domain
+type DomainDesc struct {
+	OID      uint32
+	Schema   string
+	Name     string
+	BaseType ColDesc
+	NotNull  bool
+	Default  string
+	Checks   []ConstraintDesc
+}
+
+// QualifiedName - schema qualified type name
+func (d *DomainDesc) QualifiedName() string {
+	return d.Schema + "." + d.Name
+}
+
+// GoName - name of the generated go type
+func (d *DomainDesc) GoName() string {
+	if d.Schema == "public" {
+		return convertCase(d.Name)
+	}
+	return convertCase(d.Schema) + convertCase(d.Name)
+}
+
+// ProcessEnumMetadata - reads the enums defined in the given schemas, along
+// with those defined elsewhere but used by tables in the given schemas
+func ProcessEnumMetadata(db *DBase, schemas []string) map[string]*EnumDesc {
+	conn := db.ConnPool
+	enums := map[string]*EnumDesc{}
+	rows, err := conn.Query(`
+		select t.oid, n.nspname, t.typname,
+			array(select e.enumlabel::text from pg_enum e where e.enumtypid = t.oid
+				order by e.enumsortorder)
+		from pg_type t
+		join pg_namespace n on n.oid = t.typnamespace
+		where t.typtype = 'e' and `+usedTypesCondition+`
+		order by n.nspname, t.typname
+		`, schemas)
+	if err != nil {
+		fmt.Println("***ERROR*** : Reading pg_enum. Error = ", err)
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e := EnumDesc{}
+		var oid pgtype.OID
+		if err := rows.Scan(&oid, &e.Schema, &e.Name, &e.Labels); err != nil {
+			fmt.Println("***ERROR***", "Generate", err)
+			return nil
+		}
+		e.OID = uint32(oid)
+		enums[e.QualifiedName()] = &e
+	}
+	return enums
+}
+
+// usedTypesCondition - restricts pg_type t to the types defined in the given
+// schemas and those used by the tables in the given schemas
+const usedTypesCondition = `(n.nspname = any($1) or t.oid in (
+			select a.atttypid from pg_attribute a
+			join pg_class c on c.oid = a.attrelid
+			join pg_namespace cn on cn.oid = c.relnamespace
+			where cn.nspname = any($1)))`
+
+// ProcessCompositeMetadata - reads the composite types defined in, or used
+// by, the given schemas along with their attributes. Row types of tables are
+// not included
+func ProcessCompositeMetadata(db *DBase, schemas []string) map[string]*CompositeDesc {
+	conn := db.ConnPool
+	composites := map[string]*CompositeDesc{}
+	rows, err := conn.Query(`
+		select t.oid, n.nspname, t.typname, a.attnum, a.attname,
+			case when at.typcategory = 'A' then 'ARRAY'
+				when at.typtype = 'd' then format_type(at.typbasetype, null)
+				when at.typtype in ('e', 'c') then 'USER-DEFINED'
+				else format_type(a.atttypid, null) end,
+			a.atttypid, a.atttypmod, at.typname, atn.nspname, at.typtype::text, at.typelem,
+			a.attndims
+		from pg_type t
+		join pg_namespace n on n.oid = t.typnamespace
+		join pg_class c on c.oid = t.typrelid and c.relkind = 'c'
+		join pg_attribute a on a.attrelid = c.oid and a.attnum > 0 and not a.attisdropped
+		join pg_type at on at.oid = a.atttypid
+		join pg_namespace atn on atn.oid = at.typnamespace
+		where t.typtype = 'c' and `+usedTypesCondition+`
+		order by n.nspname, t.typname, a.attnum
+		`, schemas)
+	if err != nil {
+		fmt.Println("***ERROR*** : Reading composite types. Error = ", err)
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		attr := ColDesc{IsNullable: true}
+		var oid, typeOID, elemOID pgtype.OID
+		err := rows.Scan(&oid, &attr.TableSchema, &attr.TableName, &attr.OrdinalPosition,
+			&attr.ColumnName, &attr.DataType, &typeOID, &attr.TypeMod, &attr.TypeName,
+			&attr.TypeSchema, &attr.TypeKind, &elemOID, &attr.Dimensions)
+		if err != nil {
+			fmt.Println("***ERROR***", "Generate", err)
+			return nil
+		}
+		attr.TypeOID = uint32(typeOID)
+		attr.ElemTypeOID = uint32(elemOID)
+		key := attr.TableSchema + "." + attr.TableName
+		c, ok := composites[key]
+		if !ok {
+			c = &CompositeDesc{OID: uint32(oid), Schema: attr.TableSchema, Name: attr.TableName,
+				Attributes: []ColDesc{}}
+			composites[key] = c
+		}
+		c.Attributes = append(c.Attributes, attr)
+	}
+	return composites
+}
+
+// ProcessDomainMetadata - reads the domains defined in, or used by, the
+// given schemas along with their CHECK constraints
+func ProcessDomainMetadata(db *DBase, schemas []string) map[string]*DomainDesc {
+	conn := db.ConnPool
+	domains := map[string]*DomainDesc{}
+	rows, err := conn.Query(`
+		select t.oid, n.nspname, t.typname,
+			case when bt.typcategory = 'A' then 'ARRAY'
+				when bt.typtype = 'd' then format_type(bt.typbasetype, null)
+				when bt.typtype in ('e', 'c') then 'USER-DEFINED'
+				else format_type(t.typbasetype, null) end,
+			t.typbasetype, t.typtypmod, bt.typname, bn.nspname, bt.typtype::text, bt.typelem,
+			t.typndims, t.typnotnull, coalesce(t.typdefault, ''),
+			array(select con.conname::text from pg_constraint con
+				where con.contypid = t.oid and con.contype = 'c' order by con.conname),
+			array(select pg_get_constraintdef(con.oid) from pg_constraint con
+				where con.contypid = t.oid and con.contype = 'c' order by con.conname)
+		from pg_type t
+		join pg_namespace n on n.oid = t.typnamespace
+		join pg_type bt on bt.oid = t.typbasetype
+		join pg_namespace bn on bn.oid = bt.typnamespace
+		where t.typtype = 'd' and `+usedTypesCondition+`
+		order by n.nspname, t.typname
+		`, schemas)
+	if err != nil {
+		fmt.Println("***ERROR*** : Reading domains. Error = ", err)
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := DomainDesc{}
+		base := &d.BaseType
+		var oid, typeOID, elemOID pgtype.OID
+		var checkNames, checkDefs []string
+		err := rows.Scan(&oid, &d.Schema, &d.Name, &base.DataType, &typeOID, &base.TypeMod,
+			&base.TypeName, &base.TypeSchema, &base.TypeKind, &elemOID, &base.Dimensions,
+			&d.NotNull, &d.Default, &checkNames, &checkDefs)
+		if err != nil {
+			fmt.Println("***ERROR***", "Generate", err)
+			return nil
+		}
+		d.OID = uint32(oid)
+		base.TableSchema = d.Schema
+		base.TableName = d.Name
+		base.TypeOID = uint32(typeOID)
+		base.ElemTypeOID = uint32(elemOID)
+		base.IsNullable = !d.NotNull
+		d.Checks = []ConstraintDesc{}
+		for i, name := range checkNames {
+			d.Checks = append(d.Checks, ConstraintDesc{Name: name, Type: "CHECK", Definition: checkDefs[i]})
+		}
+		domains[d.QualifiedName()] = &d
+	}
+	return domains
+}
+
+// enumFor - the enum type of the column, if any. Columns read from the
+// database are matched by type OID, those from migration files by name
+func (meta *DBMeta) enumFor(col *ColDesc) *EnumDesc {
+	for _, e := range meta.Enums {
+		if e.OID != 0 && e.OID == col.TypeOID {
+			return e
+		}
+	}
+	if e, ok := meta.Enums[col.TypeSchema+"."+col.TypeName]; ok && col.TypeKind != "b" {
+		return e
+	}
+	return nil
+}
+
+// compositeFor - the composite type of the column, if any. Matched like
+// enumFor
+func (meta *DBMeta) compositeFor(col *ColDesc) *CompositeDesc {
+	for _, c := range meta.Composites {
+		if c.OID != 0 && c.OID == col.TypeOID {
+			return c
+		}
+	}
+	if c, ok := meta.Composites[col.TypeSchema+"."+col.TypeName]; ok && col.TypeKind != "b" {
+		return c
+	}
+	return nil
+}
+
+// domainFor - the domain of the column, if any. Matched like enumFor
+func (meta *DBMeta) domainFor(col *ColDesc) *DomainDesc {
+	for _, d := range meta.Domains {
+		if d.OID != 0 && d.OID == col.TypeOID {
+			return d
+		}
+	}
+	if d, ok := meta.Domains[col.TypeSchema+"."+col.TypeName]; ok && col.TypeKind != "b" {
+		return d
+	}
+	return nil
+}
+
+// domainVOTypes - VO types for which a domain gets its own named go type.
+// Other domains use the VO type of their base type
+var domainVOTypes = map[string]bool{
+	"string": true, "bool": true, "int": true, "int64": true, "float32": true, "float64": true,
+}
+
+// hasNamedType - true if the domain gets its own go type, given the go type
+// information of its base type
+func (d *DomainDesc) hasNamedType(base *GoColInfo) bool {
+	return domainVOTypes[base.voType] && base.enum == nil && base.pgValueField != "Time"
+}
+
+// goColInfo - go type information for the column. The TimeMode of the
+// config decides the VO type of time based columns, a matching type override
+// replaces the VO type
+func (meta *DBMeta) goColInfo(col *ColDesc) GoColInfo {
+	info := meta.typeColInfo(col)
+	if info.pgValueField == "Time" && meta.timeMode == "time" {
+		info.voType = "time.Time"
+		info.nullValue = "time.Time{}"
+	}
+	if o := meta.overrideFor(col); o != nil {
+		info = o.apply(info)
+		// The override functions of pgx v5 and database/sql convert through
+		// the text Rec only
+		if len(meta.target()) > 0 && info.recType != meta.textRecType() && len(info.unsupported) == 0 {
+			info.unsupported = "the type override to " + o.GoType
+		}
+	}
+	info.target = meta.target()
+	return info
+}
+
+// typeColInfo - go type information for the type of the column. Arrays and
+// user defined types take precedence over the built in types
+func (meta *DBMeta) typeColInfo(col *ColDesc) GoColInfo {
+	if col.isArray() {
+		return meta.arrayColInfo(col)
+	}
+	if d := meta.domainFor(col); d != nil {
+		info := meta.goColInfo(&d.BaseType)
+		if d.hasNamedType(&info) {
+			info.voType = d.GoName()
+		}
+		info.domain = d
+		return info
+	}
+	if c := meta.compositeFor(col); c != nil {
+		info := GoColInfo{
+			voType:       c.GoName(),
+			recType:      c.GoName() + "Rec",
+			nullValue:    c.GoName() + "{}",
+			pgValueField: "Value",
+			pgTypeCast:   c.GoName() + "(",
+			composite:    c,
+		}
+		// The Rec of pgx v5 and database/sql has a Value method, as a
+		// driver.Valuer
+		if len(meta.target()) > 0 {
+			info.pgValueField = "V"
+		}
+		return info
+	}
+	if e := meta.enumFor(col); e != nil {
+		info := GoColInfo{
+			voType:       e.GoName(),
+			recType:      "pgtype.Text",
+			nullValue:    `""`,
+			pgValueField: "String",
+			pgTypeCast:   "string(",
+			enum:         e,
+		}
+		if meta.target() == "sql" {
+			info.recType = "sql.NullString"
+		}
+		return info
+	}
+	switch meta.target() {
+	case "pgx5":
+		return pgx5ColInfo(getGoColInfo(col))
+	case "sql":
+		return sqlColInfo(getGoColInfo(col))
+	}
+	return getGoColInfo(col)
+}
+
+// configure - applies the go type options of the config, working out the go
+// types again
+func (meta *DBMeta) configure(v *Genstruct) error {
+	if err := checkTimeConfig(v); err != nil {
+		return err
+	}
+	if !nullModes[v.NullMode] {
+		return fmt.Errorf("unknown NullMode %q, expected sentinel, pointer, sql or optional", v.NullMode)
+	}
+	if err := checkTagConfig(&v.Tags); err != nil {
+		return err
+	}
+	if !pgxVersions[v.PgxVersion] {
+		return fmt.Errorf("unknown PgxVersion %d, expected 3 or 5", v.PgxVersion)
+	}
+	if !backends[v.Backend] {
+		return fmt.Errorf("unknown Backend %q, expected pgx or database/sql", v.Backend)
+	}
+	if v.Backend == "database/sql" && v.PgxVersion != 0 {
+		return fmt.Errorf("PgxVersion does not apply to Backend database/sql")
+	}
+	meta.overrides = &v.TypeOverrides
+	meta.timeMode = v.TimeMode
+	meta.timeZone = v.TimeZone
+	meta.nullMode = v.NullMode
+	meta.tags = &v.Tags
+	meta.pgxVersion = v.PgxVersion
+	meta.backend = v.Backend
+	meta.prepare()
+	meta.checkTypeOverrides()
+	return nil
+}
+
+// prepare - works out the go types and column summaries, once all metadata
+// has been loaded
+func (meta *DBMeta) prepare() {
+	for _, mp := range meta.Tables {
+		mp.buildColSummary(meta)
+	}
+	for name, q := range meta.Queries {
+		setQueryColInfo(meta, q.Columns)
+		for i := range q.Columns {
+			q.Columns[i].goInfo = meta.nullableColInfo(&q.Columns[i])
+			q.Columns[i].goInfo.tag = meta.voTag("", name, &q.Columns[i], nil)
+		}
+	}
+	for _, c := range meta.Composites {
+		setQueryColInfo(meta, c.Attributes)
+		for i := range c.Attributes {
+			// The attributes of a composite type can always be NULL
+			c.Attributes[i].goInfo.nullable = true
+			c.Attributes[i].goInfo.tag = meta.voTag(c.Schema, c.Name, &c.Attributes[i], nil)
+		}
+	}
+}
@@ -3,29 +3,141 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"strings"
 	"unicode"
 )
 
+// convertCase - snake case database name turned into an exported go name
 func convertCase(name string) string {
-	b := []byte(name)
-	nb := []byte{}
-	nb = append(nb, byte(unicode.ToUpper(rune(b[0]))))
-	usSeen := false
-	for i := 1; i < len(b); i++ {
-		if b[i] == '_' {
-			usSeen = true
-		} else {
-			if usSeen {
-				nb = append(nb, byte(unicode.ToUpper(rune(b[i]))))
-				usSeen = false
-			} else {
-				nb = append(nb, b[i])
-			}
+	nb := []rune{}
+	upper := true
+	for _, r := range name {
+		// Characters that can not be part of an identifier act as word
+		// separators, like the underscore
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
 		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		nb = append(nb, r)
+	}
+	if len(nb) > 0 && unicode.IsDigit(nb[0]) {
+		nb = append([]rune{'X'}, nb...)
 	}
 	return string(nb)
 }
 
+// reservedNames - go keywords and predeclared identifiers, along with the
+// names used inside generated methods, which can not be used as parameters
+var reservedNames = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+	"bool": true, "byte": true, "error": true, "int": true, "int64": true,
+	"string": true, "nil": true, "true": true, "false": true, "len": true,
+	"t": true, "c": true, "r": true, "err": true, "queryKey": true,
+}
+
+// goParamName - lower camel case parameter name for a column
+func goParamName(name string) string {
+	goName := convertCase(name)
+	paramName := string(unicode.ToLower(rune(goName[0]))) + goName[1:]
+	if reservedNames[paramName] {
+		paramName += "Param"
+	}
+	return paramName
+}
+
+// sqlKeywords - the postgres keywords. quoteIdent quotes all of them, not
+// just the reserved ones, as unreserved keywords like type or range are only
+// accepted as names in some places
+var sqlKeywords = map[string]bool{}
+
+func init() {
+	for _, kw := range strings.Fields(`abort absent absolute access action add admin after aggregate all also alter
+always analyse analyze and any array as asc asensitive assertion assignment
+asymmetric at atomic attach attribute authorization backward before begin
+between bigint binary bit boolean both breadth by cache call called cascade
+cascaded case cast catalog chain char character characteristics check
+checkpoint class close cluster coalesce collate collation column columns
+comment comments commit committed compression concurrently configuration
+conflict connection constraint constraints content continue conversion copy
+cost create cross csv cube current current_catalog current_date current_role
+current_schema current_time current_timestamp current_user cursor cycle data
+database day deallocate dec decimal declare default defaults deferrable
+deferred definer delete delimiter delimiters depends depth desc detach
+dictionary disable discard distinct do document domain double drop each else
+enable encoding encrypted end enum escape event except exclude excluding
+exclusive execute exists explain expression extension external extract false
+family fetch filter finalize first float following for force foreign format
+forward freeze from full function functions generated global grant granted
+greatest group grouping groups handler having header hold hour identity if
+ilike immediate immutable implicit import in include including increment
+indent index indexes inherit inherits initially inline inner inout input
+insensitive insert instead int integer intersect interval into invoker is
+isnull isolation join json json_array json_arrayagg json_object
+json_objectagg key keys label language large last lateral leading leakproof
+least left level like limit listen load local localtime localtimestamp
+location lock locked logged mapping match matched materialized maxvalue
+merge method minute minvalue mode month move name names national natural
+nchar new next nfc nfd nfkc nfkd no none normalize normalized not nothing
+notify notnull nowait null nullif nulls numeric object of off offset oids
+old on only operator option options or order ordinality others out outer
+over overlaps overlay overriding owned owner parallel parameter parser
+partial partition passing password placing plans policy position preceding
+precision prepare prepared preserve primary prior privileges procedural
+procedure procedures program publication quote range read real reassign
+recheck recursive ref references referencing refresh reindex relative
+release rename repeatable replace replica reset restart restrict return
+returning returns revoke right role rollback rollup routine routines row
+rows rule savepoint scalar schema schemas scroll search second security
+select sequence sequences serializable server session session_user set
+setof sets share show similar simple skip smallint snapshot some sql stable
+standalone start statement statistics stdin stdout storage stored strict
+strip subscription substring support symmetric sysid system system_user
+table tables tablesample tablespace temp template temporary text then ties
+time timestamp to trailing transaction transform treat trigger trim true
+truncate trusted type types uescape unbounded uncommitted unencrypted union
+unique unknown unlisten unlogged until update user using vacuum valid
+validate validator value values varchar variadic varying verbose version
+view views volatile when where whitespace window with within without work
+wrapper write xml xmlattributes xmlconcat xmlelement xmlexists xmlforest
+xmlnamespaces xmlparse xmlpi xmlroot xmlserialize xmltable year yes zone`) {
+		sqlKeywords[kw] = true
+	}
+}
+
+// quoteIdent - database name quoted for the generated SQL following the
+// quote_ident function of postgres: names other than lower case letters,
+// digits and underscores, and the keywords, are quoted
+func quoteIdent(name string) string {
+	plain := len(name) > 0 && !sqlKeywords[name] && !unicode.IsDigit(rune(name[0]))
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z') && !unicode.IsDigit(r) && r != '_' {
+			plain = false
+		}
+	}
+	if plain {
+		return name
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// containsInt - true if list holds n
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
 var _global_writer *bufio.Writer
 
 func pp(args ...interface{}) {